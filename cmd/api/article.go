@@ -1,6 +1,7 @@
 package main
 
 import (
+	"blogalusta/internal/data"
 	"blogalusta/internal/forms"
 	"net/http"
 )
@@ -11,30 +12,50 @@ func (app *application) handleShowArticlePage(w http.ResponseWriter, r *http.Req
 	article := app.article(r)
 	user := app.authenticatedUser(r)
 
-	td.Like, err = app.models.Articles.Likes(article, user)
+	if app.notModified(w, r, func() (*data.Freshness, error) {
+		return app.models.Articles.Freshness(r.Context(), article)
+	}) {
+		return
+	}
+
+	td.Like, err = app.models.Articles.Likes(r.Context(), article, user)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	td.Comments, err = app.models.Comments.Retrieve(article)
+	td.Comments, err = app.models.Comments.Retrieve(r.Context(), article)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	td.UserMap, err = app.models.Comments.Commenters(td.Comments, nil)
+	td.UserMap, err = app.loader(r).commenters(td.Comments)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	td.LikeMap, err = app.models.Comments.LikesMany(td.Comments, user)
+	td.LikeMap, err = app.models.Comments.LikesMany(r.Context(), td.Comments, user)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	if user != nil {
+		td.IsBookmarked, err = app.models.Bookmarks.Exists(r.Context(), user, article)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		td.ReadingLists, err = app.models.ReadingLists.ForUser(r.Context(), user, true)
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
+	}
+
 	app.render(w, r, "article.page.gohtml", td)
 }
 
@@ -43,12 +64,12 @@ func (app *application) handleLikeArticle(w http.ResponseWriter, r *http.Request
 	publication := app.publication(r)
 	article := app.article(r)
 
-	err := app.likeArticle(w, user, article)
+	like, err := app.likeArticle(w, r, user, article)
 	if err != nil {
 		return
 	}
 
-	http.Redirect(w, r, publication.GetArticleURL(article), http.StatusSeeOther)
+	app.respondLike(w, r, like, publication.GetArticleURL(article))
 }
 
 func (app *application) handleUnlikeArticle(w http.ResponseWriter, r *http.Request) {
@@ -56,12 +77,12 @@ func (app *application) handleUnlikeArticle(w http.ResponseWriter, r *http.Reque
 	publication := app.publication(r)
 	article := app.article(r)
 
-	err := app.unlikeArticle(w, user, article)
+	like, err := app.unlikeArticle(w, r, user, article)
 	if err != nil {
 		return
 	}
 
-	http.Redirect(w, r, publication.GetArticleURL(article), http.StatusSeeOther)
+	app.respondLike(w, r, like, publication.GetArticleURL(article))
 }
 
 func (app *application) handleCreateComment(w http.ResponseWriter, r *http.Request) {
@@ -83,12 +104,17 @@ func (app *application) handleCreateComment(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Articles.Comment(article, user, form.Get("content"))
+	err = app.models.Articles.Comment(r.Context(), article, user, form.Get("content"))
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	err = app.models.Notifications.CommentCreated(r.Context(), article, user)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
 	http.Redirect(w, r, publication.GetArticleURL(article)+"#comments", http.StatusSeeOther)
 }
 
@@ -105,23 +131,23 @@ func (app *application) handleLikeComment(w http.ResponseWriter, r *http.Request
 	user := app.authenticatedUser(r)
 	comment := app.comment(r)
 
-	hasLiked, err := app.models.Comments.UserHasLiked(comment, user)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
+	like, liked, err := app.models.Users.LikeComment(r.Context(), user, comment)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
 		return
-	}
-	if hasLiked {
-		app.clientError(w, http.StatusBadRequest)
+	} else if err != nil {
+		app.serverError(w, err)
 		return
 	}
 
-	err = app.models.Users.LikeComment(user, comment)
-	if err != nil {
-		app.serverError(w, err)
-		return
+	if liked {
+		err = app.models.Notifications.CommentLiked(r.Context(), article, comment, user)
+		if err != nil {
+			app.errorLog.Print(err)
+		}
 	}
 
-	http.Redirect(w, r, publication.GetArticleURL(article)+"#comments", http.StatusSeeOther)
+	app.respondLike(w, r, like, publication.GetArticleURL(article)+"#comments")
 }
 
 func (app *application) handleUnlikeComment(w http.ResponseWriter, r *http.Request) {
@@ -130,22 +156,14 @@ func (app *application) handleUnlikeComment(w http.ResponseWriter, r *http.Reque
 	user := app.authenticatedUser(r)
 	comment := app.comment(r)
 
-	hasLiked, err := app.models.Comments.UserHasLiked(comment, user)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return
-	}
-
-	if !hasLiked {
-		app.clientError(w, http.StatusBadRequest)
+	like, err := app.models.Users.UnlikeComment(r.Context(), user, comment)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
 		return
-	}
-
-	err = app.models.Users.UnlikeComment(user, comment)
-	if err != nil {
+	} else if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	http.Redirect(w, r, publication.GetArticleURL(article)+"#comments", http.StatusSeeOther)
+	app.respondLike(w, r, like, publication.GetArticleURL(article)+"#comments")
 }
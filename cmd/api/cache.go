@@ -0,0 +1,144 @@
+package main
+
+import (
+	"blogalusta/internal/cache"
+	"blogalusta/internal/data"
+	"context"
+	"html/template"
+	"strconv"
+	"strings"
+)
+
+// cacheChannel is the PostgreSQL channel the instances announce the cache
+// entries they invalidate on.
+const cacheChannel = "cache"
+
+// articleVersion identifies the content of an article and the settings of
+// its publication it is rendered with. Edits bump the versions, so the HTML
+// rendered from older content or settings is never served again.
+type articleVersion struct {
+	id                 int
+	version            int
+	publicationVersion int
+}
+
+// caches holds the lookups that are made on nearly every request. Records
+// are stored by value so that requests can't change each other's copies.
+type caches struct {
+	publications *cache.LRU[string, data.Publication]
+	users        *cache.LRU[int, data.User]
+	html         *cache.LRU[articleVersion, template.HTML]
+	pages        *cache.LRU[string, cachedPage]
+	images       *cache.LRU[string, cachedImage]
+	imageHashes  *cache.LRU[int, string]
+
+	// db announces invalidations to the other instances, nil when cache
+	// notifications are off
+	db *data.DB
+}
+
+func newCaches(cfg config, db *data.DB) *caches {
+	c := &caches{
+		publications: cache.New[string, data.Publication](cfg.cache.size, cfg.cache.ttl),
+		users:        cache.New[int, data.User](cfg.cache.size, cfg.cache.ttl),
+		html:         cache.New[articleVersion, template.HTML](cfg.cache.size, cfg.cache.ttl),
+		pages:        cache.New[string, cachedPage](0, 0),
+		images:       cache.NewWeighted[string, cachedImage](cfg.cache.imageBytes, cfg.cache.ttl, byteLen),
+		imageHashes:  cache.New[int, string](cfg.cache.size, cfg.cache.ttl),
+	}
+	if cfg.http.pageCacheTTL > 0 {
+		c.pages = cache.New[string, cachedPage](cfg.cache.size, cfg.http.pageCacheTTL)
+	}
+	if cfg.cache.notify {
+		c.db = db
+	}
+	return c
+}
+
+// byteLen weighs the images in their cache, which is bounded by bytes as
+// images vary from small avatars to large originals.
+func byteLen(img cachedImage) int {
+	return len(img.content)
+}
+
+// evict removes the entry named in a notification of another instance.
+func (c *caches) evict(payload string) {
+	kind, key, _ := strings.Cut(payload, ":")
+	switch kind {
+	case "publication":
+		c.publications.Delete(key)
+	case "user":
+		id, err := strconv.Atoi(key)
+		if err == nil {
+			c.users.Delete(id)
+		}
+	}
+}
+
+func (c *caches) clear() {
+	c.publications.Clear()
+	c.users.Clear()
+}
+
+func (app *application) publicationBySlug(ctx context.Context, slug string) (*data.Publication, error) {
+	if p, ok := app.cache.publications.Get(slug); ok {
+		return &p, nil
+	}
+
+	p, err := app.models.Publications.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	app.cache.publications.Set(slug, *p)
+
+	return p, nil
+}
+
+func (app *application) userByID(ctx context.Context, id int) (*data.User, error) {
+	if u, ok := app.cache.users.Get(id); ok {
+		return &u, nil
+	}
+
+	u, err := app.models.Users.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	app.cache.users.Set(id, *u)
+
+	return u, nil
+}
+
+// articleHTML returns the article content rendered to sanitised HTML, with
+// the options of the publication.
+func (app *application) articleHTML(ctx context.Context, article *data.Article, publication *data.Publication) template.HTML {
+	key := articleVersion{article.ID, article.Version, publication.Version}
+	if html, ok := app.cache.html.Get(key); ok {
+		return html
+	}
+
+	html := template.HTML(app.markdown.Render(ctx, article.Content, markdownOptions(publication)))
+	app.cache.html.Set(key, html)
+
+	return html
+}
+
+func (app *application) invalidatePublication(ctx context.Context, slug string) {
+	app.cache.publications.Delete(slug)
+	app.announceInvalidation(ctx, "publication:"+slug)
+}
+
+func (app *application) invalidateUser(ctx context.Context, id int) {
+	app.cache.users.Delete(id)
+	app.announceInvalidation(ctx, "user:"+strconv.Itoa(id))
+}
+
+func (app *application) announceInvalidation(ctx context.Context, payload string) {
+	if app.cache.db == nil {
+		return
+	}
+
+	err := app.cache.db.Notify(ctx, cacheChannel, payload)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+}
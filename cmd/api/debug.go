@@ -0,0 +1,41 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"net/http"
+	"strconv"
+)
+
+// queryCountWriter reports the number of queries run while handling a
+// request in the X-Query-Count header. The count is taken when the response
+// header is written, so queries run after that aren't included.
+type queryCountWriter struct {
+	http.ResponseWriter
+	counter     *data.QueryCounter
+	wroteHeader bool
+}
+
+func (w *queryCountWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		w.Header().Set("X-Query-Count", strconv.FormatInt(w.counter.Count(), 10))
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *queryCountWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps the notification and article event streams working.
+func (w *queryCountWriter) Flush() {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
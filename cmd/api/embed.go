@@ -0,0 +1,58 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"blogalusta/internal/markdown"
+	"context"
+	"fmt"
+	"html"
+	"path"
+)
+
+// articleEmbed is the shortcode of other articles of the site, which the
+// markdown package knows nothing about.
+func (app *application) articleEmbed() markdown.Embed {
+	return markdown.Embed{Render: app.renderArticleEmbed}
+}
+
+// renderArticleEmbed renders a card of another article, named by its slug
+// alone or with the path of its publication before it.
+func (app *application) renderArticleEmbed(ctx context.Context, args []string) (string, bool) {
+	if len(args) != 1 {
+		return "", false
+	}
+	url, id, err := app.getSlugAndId(path.Base(args[0]))
+	if err != nil {
+		return "", false
+	}
+
+	article, err := app.models.Articles.Get(ctx, id)
+	if err == data.ErrRecordNotFound || err == nil && !article.Matches(url) {
+		return "", false
+	} else if err != nil {
+		app.errorLog.Print(err)
+		return "", false
+	}
+
+	publications, err := app.models.Publications.GetMany(ctx, []int{article.PublicationID})
+	if err != nil {
+		app.errorLog.Print(err)
+		return "", false
+	}
+	publication, ok := publications[article.PublicationID]
+	if !ok {
+		return "", false
+	}
+
+	writer, err := app.userByID(ctx, article.WriterID)
+	if err != nil {
+		app.errorLog.Print(err)
+		return "", false
+	}
+
+	return fmt.Sprintf(`<div class="embed embed-article"><p><a href="%s"><b>%s</b></a></p>`+
+		`<p class="embed-note">%s in <a href="%s">%s</a>, %s</p></div>`+"\n",
+		html.EscapeString(publication.GetArticleURL(article)), html.EscapeString(article.Title),
+		html.EscapeString(writer.Name), html.EscapeString(publication.GetBaseURL()),
+		html.EscapeString(publication.Name), article.CreatedAt.Format("02 Jan 2006")), true
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// streamDuration is how long a single event stream is kept open. It has to
+// stay under the server WriteTimeout; browsers reconnect on their own.
+const streamDuration = 25 * time.Second
+
+type event struct {
+	Topic string          `json:"topic"`
+	Name  string          `json:"event"`
+	Data  json.RawMessage `json:"data"`
+}
+
+// broker fans out events to the event streams open on this instance.
+type broker struct {
+	mu          sync.Mutex
+	subscribers map[string]map[chan event]struct{}
+}
+
+func newBroker() *broker {
+	return &broker{
+		subscribers: make(map[string]map[chan event]struct{}),
+	}
+}
+
+func (b *broker) subscribe(topic string) chan event {
+	ch := make(chan event, 16)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.subscribers[topic] == nil {
+		b.subscribers[topic] = make(map[chan event]struct{})
+	}
+	b.subscribers[topic][ch] = struct{}{}
+
+	return ch
+}
+
+func (b *broker) unsubscribe(topic string, ch chan event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.subscribers[topic], ch)
+	if len(b.subscribers[topic]) == 0 {
+		delete(b.subscribers, topic)
+	}
+}
+
+func (b *broker) hasSubscribers(topic string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers[topic]) > 0
+}
+
+func (b *broker) publish(e event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subscribers[e.Topic] {
+		// slow streams miss events rather than block everyone else
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// listenEvents relays the events sent by the database triggers on the events
+// channel to the broker. Every instance listens separately, so an action on
+// one instance reaches streams open on all of them. With cache notifications
+// on it also evicts the cache entries other instances have invalidated.
+func (app *application) listenEvents(dsn string) {
+	listener := pq.NewListener(dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+	})
+
+	err := listener.Listen("events")
+	if err != nil {
+		app.errorLog.Print(err)
+		return
+	}
+
+	if app.config.cache.notify {
+		err = listener.Listen(cacheChannel)
+		if err != nil {
+			app.errorLog.Print(err)
+			return
+		}
+	}
+
+	for {
+		select {
+		case n := <-listener.Notify:
+			// nil is sent after the connection has been re-established
+			if n == nil {
+				// invalidations may have been missed in the meantime
+				if app.config.cache.notify {
+					app.cache.clear()
+				}
+				continue
+			}
+
+			if n.Channel == cacheChannel {
+				app.cache.evict(n.Extra)
+				continue
+			}
+
+			var e event
+			err := json.Unmarshal([]byte(n.Extra), &e)
+			if err != nil {
+				app.errorLog.Print(err)
+				continue
+			}
+
+			if !app.events.hasSubscribers(e.Topic) {
+				continue
+			}
+
+			if e.Name == "comment" {
+				e.Data, err = app.commentEventData(context.Background(), e.Data)
+				if err != nil {
+					app.errorLog.Print(err)
+					continue
+				}
+			}
+
+			app.events.publish(e)
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
+
+// commentEventData replaces the comment id sent by the trigger with what is
+// needed to display the comment, as the whole comment may not fit in a
+// notification payload.
+func (app *application) commentEventData(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	var payload struct {
+		ID int `json:"id"`
+	}
+	err := json.Unmarshal(raw, &payload)
+	if err != nil {
+		return nil, err
+	}
+
+	comment, err := app.models.Comments.Get(ctx, payload.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	commenter, err := app.userByID(ctx, comment.CommenterID)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":        comment.ID,
+		"content":   comment.Content,
+		"createdAt": rfc3339(comment.CreatedAt),
+		"humanDate": humanDate(comment.CreatedAt),
+		"commenter": map[string]string{
+			"name": commenter.Name,
+			"url":  userURL(commenter),
+			"pic":  userPic(commenter, 32),
+		},
+	})
+}
+
+func (app *application) streamEvents(w http.ResponseWriter, r *http.Request, topic string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		app.serverError(w, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	ch := app.events.subscribe(topic)
+	defer app.events.unsubscribe(topic, ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprintf(w, "retry: %d\n\n", 1000)
+	flusher.Flush()
+
+	timeout := time.NewTimer(streamDuration)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case e := <-ch:
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.Name, e.Data)
+			flusher.Flush()
+		case <-timeout.C:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (app *application) handleArticleEvents(w http.ResponseWriter, r *http.Request) {
+	app.streamEvents(w, r, "article:"+strconv.Itoa(app.article(r).ID))
+}
+
+func (app *application) handleNotificationEvents(w http.ResponseWriter, r *http.Request) {
+	app.streamEvents(w, r, "user:"+strconv.Itoa(app.authenticatedUser(r).ID))
+}
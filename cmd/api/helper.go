@@ -3,14 +3,15 @@ package main
 import (
 	"blogalusta/internal/data"
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/gomarkdown/markdown"
 	"github.com/justinas/nosurf"
 	"golang.org/x/image/draw"
-	"html/template"
 	"image"
+	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime/debug"
 	"strconv"
@@ -18,6 +19,13 @@ import (
 	"time"
 )
 
+func getEnvString(key string, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
 func getEnvInt(key string, fallback int) int {
 	if value, ok := os.LookupEnv(key); ok {
 		if i, err := strconv.Atoi(value); err == nil {
@@ -60,24 +68,27 @@ func (app *application) addDefaultData(td *templateData, r *http.Request) *templ
 		td = &templateData{}
 	}
 	td.CSRFToken = nosurf.Token(r)
+	td.BaseURL = app.config.baseURL
 	td.CurrentYear = time.Now().Year()
+	td.Query = r.URL.Query()
+	if td.Metadata.Next != nil {
+		td.NextCursor = td.Metadata.Next.Sign([]byte(app.config.secret))
+	}
+	if td.Metadata.Prev != nil {
+		td.PrevCursor = td.Metadata.Prev.Sign([]byte(app.config.secret))
+	}
 	td.Flash = app.session.PopString(r, "flash")
 	td.FlashError = app.session.PopString(r, "flash_error")
 	td.AuthenticatedUser = app.authenticatedUser(r)
 	td.Publication = app.publication(r)
+	td.loader = app.loader(r)
 	td.Article = app.article(r)
 	if td.Article != nil {
-		td.HTML = template.HTML(app.markdownToHTML(td.Article.Content))
-		td.Article.Writer, _ = app.models.Users.Get(td.Article.WriterID)
+		td.HTML = app.articleHTML(r.Context(), td.Article, td.Publication)
+		td.Article.Writer, _ = td.loader.user(td.Article.WriterID)
 	}
 	td.ProfileUser = app.profileUser(r)
-	td.Writers = app.writers(r)
-	td.InvitedWriters = app.pending(r)
-	if td.AuthenticatedUser != nil {
-		td.IsSubscribed, _ = app.models.Publications.UserIsSubscribed(td.Publication, td.AuthenticatedUser)
-		td.HasPublications, _ = app.models.Users.HasPublication(td.AuthenticatedUser)
-		td.HasInvitations, _ = app.models.Users.HasInvitations(td.AuthenticatedUser)
-	}
+	td.Meta = app.pageMeta(r, td)
 	return td
 }
 
@@ -90,6 +101,7 @@ func (app *application) render(w http.ResponseWriter, r *http.Request, name stri
 
 	buf := new(bytes.Buffer)
 
+	app.setCacheControl(w, r)
 	err := ts.Execute(buf, app.addDefaultData(td, r))
 	if err != nil {
 		app.serverError(w, err)
@@ -127,12 +139,6 @@ func (app *application) getSlugAndId(url string) (string, int, error) {
 	return slug, id, nil
 }
 
-func (app *application) markdownToHTML(md string) []byte {
-	normalized := markdown.NormalizeNewlines([]byte(md))
-	unsafeHTML := markdown.ToHTML(normalized, nil, app.markdown.renderer)
-	return app.markdown.policy.SanitizeBytes(unsafeHTML)
-}
-
 func (app *application) article(r *http.Request) *data.Article {
 	article, ok := r.Context().Value(contextKeyArticle).(*data.Article)
 	if !ok {
@@ -149,103 +155,258 @@ func (app *application) profileUser(r *http.Request) *data.User {
 	return user
 }
 
-func (app *application) writers(r *http.Request) []*data.User {
-	writers, ok := r.Context().Value(contextKeyWriters).([]*data.User)
+func (app *application) comment(r *http.Request) *data.Comment {
+	comment, ok := r.Context().Value(contextKeyComment).(*data.Comment)
 	if !ok {
 		return nil
 	}
-	return writers
+	return comment
 }
 
-func (app *application) pending(r *http.Request) []*data.User {
-	pending, ok := r.Context().Value(contextKeyPending).([]*data.User)
+func (app *application) readingList(r *http.Request) *data.ReadingList {
+	list, ok := r.Context().Value(contextKeyReadingList).(*data.ReadingList)
 	if !ok {
 		return nil
 	}
-	return pending
+	return list
 }
 
-func (app *application) comment(r *http.Request) *data.Comment {
-	comment, ok := r.Context().Value(contextKeyComment).(*data.Comment)
-	if !ok {
-		return nil
+// readImage decodes the image uploaded in the image field of a multipart
+// form of up to maxSize bytes, turned upright if it is a photo taken on its
+// side. The error response has been written if it returns an error.
+func (app *application) readImage(w http.ResponseWriter, r *http.Request, maxSize int) (image.Image, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxSize))
+	err := r.ParseMultipartForm(int64(maxSize))
+	if err != nil {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		app.errorLog.Print(err)
+		return nil, err
 	}
-	return comment
-}
 
-func cropImage(img image.Image, crop image.Rectangle) (image.Image, error) {
-	type subImager interface {
-		SubImage(r image.Rectangle) image.Image
+	file, header, err := r.FormFile("image")
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		app.errorLog.Print(err)
+		return nil, err
 	}
+	defer file.Close()
 
-	simg, ok := img.(subImager)
-	if !ok {
-		return nil, errors.New("image dose not support cropping")
+	// the CSRF check may have parsed the form already, without the limit
+	if header.Size > int64(maxSize) {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return nil, fmt.Errorf("image of %d bytes is too large", header.Size)
 	}
 
-	return simg.SubImage(crop), nil
-}
-
-func cropCenterResize(img image.Image, sideLength int) (image.Image, error) {
-	rect := img.Bounds()
-
-	if rect.Max.X < rect.Max.Y {
-		y0 := (rect.Dy() - rect.Dx()) / 2
-		y1 := rect.Dx() + y0
+	content, err := io.ReadAll(file)
+	if err != nil {
+		app.serverError(w, err)
+		return nil, err
+	}
 
-		rect = image.Rect(rect.Min.X, y0, rect.Max.X, y1)
-	} else if rect.Max.X > rect.Max.Y {
-		x0 := (rect.Dx() - rect.Dy()) / 2
-		x1 := rect.Dy() + x0
+	filetype := http.DetectContentType(content)
+	if filetype != "image/jpeg" && filetype != "image/png" && filetype != "image/gif" && filetype != "image/webp" {
+		app.clientError(w, http.StatusUnsupportedMediaType)
+		app.errorLog.Print(filetype)
+		return nil, fmt.Errorf("unsupported image type %s", filetype)
+	}
 
-		rect = image.Rect(x0, rect.Min.Y, x1, rect.Max.Y)
+	// a small file can still decode to a huge image, the header tells how
+	// huge before any memory is spent on the pixels
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		app.errorLog.Print(err)
+		return nil, err
 	}
-	img, err := cropImage(img, rect)
+	if config.Width*config.Height > app.config.imageMaxPixels {
+		app.clientError(w, http.StatusRequestEntityTooLarge)
+		return nil, fmt.Errorf("image of %dx%d pixels is too large", config.Width, config.Height)
+	}
+
+	// GIFs decode to their first frame
+	img, _, err := image.Decode(bytes.NewReader(content))
 	if err != nil {
+		app.clientError(w, http.StatusUnprocessableEntity)
+		app.errorLog.Print(err)
 		return nil, err
 	}
+
+	if filetype == "image/jpeg" {
+		img = orient(img, exifOrientation(content))
+	}
+
+	return img, nil
+}
+
+// centerSquare returns the largest square in the middle of the bounds.
+func centerSquare(bounds image.Rectangle) image.Rectangle {
+	side := bounds.Dx()
+	if bounds.Dy() < side {
+		side = bounds.Dy()
+	}
+
+	x0 := bounds.Min.X + (bounds.Dx()-side)/2
+	y0 := bounds.Min.Y + (bounds.Dy()-side)/2
+
+	return image.Rect(x0, y0, x0+side, y0+side)
+}
+
+// cropResize scales the crop of the image to a square of sideLength, laid
+// on white as JPEG has no transparency.
+func cropResize(img image.Image, crop image.Rectangle, sideLength int) image.Image {
 	dst := image.NewRGBA(image.Rect(0, 0, sideLength, sideLength))
-	draw.BiLinear.Scale(dst, dst.Rect, img, img.Bounds(), draw.Over, nil)
+	draw.Draw(dst, dst.Rect, image.White, image.Point{}, draw.Src)
+	draw.BiLinear.Scale(dst, dst.Rect, img, crop, draw.Over, nil)
 
-	return dst, nil
+	return dst
 }
 
-func (app *application) likeArticle(w http.ResponseWriter, user *data.User, article *data.Article) error {
-	hasLiked, err := app.models.Articles.UserHasLiked(article, user)
-	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return err
+func cropCenterResize(img image.Image, sideLength int) image.Image {
+	return cropResize(img, centerSquare(img.Bounds()), sideLength)
+}
+
+// readCrop returns the square of the image the user chose in the crop
+// fields of the form, the middle of the image if none was chosen.
+func readCrop(form url.Values, bounds image.Rectangle) (image.Rectangle, error) {
+	if form.Get("crop-size") == "" {
+		return centerSquare(bounds), nil
 	}
-	if hasLiked {
-		app.clientError(w, http.StatusBadRequest)
-		return errors.New("already liked")
+
+	var values [3]int
+	for i, field := range []string{"crop-x", "crop-y", "crop-size"} {
+		v, err := strconv.Atoi(form.Get(field))
+		if err != nil {
+			return image.Rectangle{}, fmt.Errorf("invalid %s", field)
+		}
+		values[i] = v
 	}
 
-	err = app.models.Users.LikeArticle(user, article)
-	if err != nil {
+	x, y, size := values[0], values[1], values[2]
+	crop := image.Rect(x, y, x+size, y+size).Add(bounds.Min)
+	if size <= 0 || !crop.In(bounds) {
+		return image.Rectangle{}, errors.New("crop outside of the image")
+	}
+
+	return crop, nil
+}
+
+// fitWidth scales the image down to maxWidth keeping its aspect ratio, and
+// lays it on white as JPEG has no transparency. Narrower images keep their
+// size.
+func fitWidth(img image.Image, maxWidth int) image.Image {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+	if width > maxWidth {
+		height = height * maxWidth / width
+		width = maxWidth
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Rect, image.White, image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Rect, img, img.Bounds(), draw.Over, nil)
+
+	return dst
+}
+
+// likeArticle likes the article for the user, notifying the writer unless
+// the user already liked it. The error response has been written if it
+// returns an error.
+func (app *application) likeArticle(w http.ResponseWriter, r *http.Request, user *data.User, article *data.Article) (*data.Like, error) {
+	like, liked, err := app.models.Users.LikeArticle(r.Context(), user, article)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
+		return nil, err
+	} else if err != nil {
 		app.serverError(w, err)
-		return err
+		return nil, err
 	}
 
-	return nil
+	if liked {
+		err = app.models.Notifications.ArticleLiked(r.Context(), article, user)
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+
+	return like, nil
 }
 
-func (app *application) unlikeArticle(w http.ResponseWriter, user *data.User, article *data.Article) error {
-	hasLiked, err := app.models.Articles.UserHasLiked(article, user)
+// unlikeArticle removes the like of the user from the article. The error
+// response has been written if it returns an error.
+func (app *application) unlikeArticle(w http.ResponseWriter, r *http.Request, user *data.User, article *data.Article) (*data.Like, error) {
+	like, err := app.models.Users.UnlikeArticle(r.Context(), user, article)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
+		return nil, err
+	} else if err != nil {
+		app.serverError(w, err)
+		return nil, err
+	}
+
+	return like, nil
+}
+
+// wantsJSON reports whether the client asked for a JSON response instead of
+// being redirected back to a page.
+func (app *application) wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func (app *application) writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	js, err := json.Marshal(v)
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		return err
+		app.serverError(w, err)
+		return
 	}
 
-	if !hasLiked {
-		app.clientError(w, http.StatusBadRequest)
-		return errors.New("not liked")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(js)
+}
+
+// respondLike answers a like or unlike request with the state of the like,
+// as JSON if the client asked for it and by redirecting to url otherwise.
+func (app *application) respondLike(w http.ResponseWriter, r *http.Request, like *data.Like, url string) {
+	if app.wantsJSON(r) {
+		app.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"liked": like.HasLiked,
+			"likes": like.Count,
+		})
+		return
+	}
+
+	http.Redirect(w, r, url, http.StatusSeeOther)
+}
+
+// readPagination sets up the pagination of the filters from the query. A
+// cursor switches to keyset pagination starting from it, and has to be for
+// the same sort as the filters. Without one, results are paged by number
+// with ?p=, the first page by default.
+func (app *application) readPagination(r *http.Request, filters *data.Filters) error {
+	values := r.URL.Query()
+	if !values.Has("cursor") {
+		filters.Page = 1
+		if values.Has("p") {
+			page, err := strconv.Atoi(values.Get("p"))
+			if err != nil || page < 1 {
+				return errors.New("invalid page")
+			}
+			filters.Page = page
+		}
+		return nil
 	}
 
-	err = app.models.Users.UnlikeArticle(user, article)
+	cursor, err := data.ParseCursor(values.Get("cursor"), []byte(app.config.secret))
 	if err != nil {
-		app.serverError(w, err)
 		return err
 	}
+	if cursor.Sort != filters.Sort {
+		return data.ErrInvalidCursor
+	}
+	filters.Keyset = true
+	filters.Cursor = cursor
+
 	return nil
 }
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+)
+
+// defaultCodeStyle is the highlighting style of publications that haven't
+// picked one.
+const defaultCodeStyle = "github"
+
+// validCodeStyle reports whether there is a highlighting style of the name.
+func validCodeStyle(name string) bool {
+	_, ok := styles.Registry[name]
+	return ok
+}
+
+// codeStyle returns the highlighting style of the publication.
+func codeStyle(name string) string {
+	if !validCodeStyle(name) {
+		return defaultCodeStyle
+	}
+	return name
+}
+
+// codeStyleURL returns the URL of the stylesheet of the highlighting style.
+func codeStyleURL(name string) string {
+	return fmt.Sprintf("/css/code/%s.css", codeStyle(name))
+}
+
+func (app *application) handleGetCodeStyle(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "style")
+	if !validCodeStyle(name) {
+		app.notFound(w)
+		return
+	}
+
+	var buf bytes.Buffer
+	formatter := chromahtml.New(chromahtml.WithClasses(true))
+	err := formatter.WriteCSS(&buf, styles.Get(name))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/css; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Write(buf.Bytes())
+}
@@ -3,39 +3,78 @@ package main
 import (
 	"blogalusta/internal/data"
 	"blogalusta/internal/forms"
+	"blogalusta/internal/markdown"
 	"github.com/go-chi/chi/v5"
 	"net/http"
 	"strconv"
+	"time"
 )
 
+// feedSorts maps the sort modes of the home feed to the columns they order by.
+var feedSorts = map[string]string{
+	"hot":    "-hot",
+	"latest": "-created_at",
+	"top":    "-likes",
+}
+
+// feedPeriods maps the periods of the top sort mode to how far back they reach.
+var feedPeriods = map[string]time.Duration{
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 30 * 24 * time.Hour,
+	"all":   0,
+}
+
 func (app *application) handleShowHomePage(w http.ResponseWriter, r *http.Request) {
-	page := 1
-	var err error
 	values := r.URL.Query()
-	if values.Has("p") {
-		page, err = strconv.Atoi(values.Get("p"))
-		if err != nil {
-			app.clientError(w, http.StatusNotFound)
-			return
-		}
-		if page < 1 {
-			app.clientError(w, http.StatusNotFound)
-			return
-		}
+	user := app.authenticatedUser(r)
+
+	// anonymous users get the top articles of the week like they always
+	// have, logged-in users their own feed ranked by what is hot
+	sort := "top"
+	if user != nil {
+		sort = "hot"
+	}
+	if values.Has("sort") {
+		sort = values.Get("sort")
+	}
+	period := "week"
+	if values.Has("t") {
+		period = values.Get("t")
+	}
+
+	column, ok := feedSorts[sort]
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+	since, ok := feedPeriods[period]
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
 	}
 
 	var filters data.Filters
-	filters.Page = page
-	filters.PageSize = 10
+	filters.PageSize = app.config.feed.pageSize
+	filters.Sort = column
+	filters.SortSafeList = []string{"-hot", "-created_at", "-likes"}
+	if sort == "top" && since > 0 {
+		filters.Since = time.Now().Add(-since)
+	}
+
+	err := app.readPagination(r, &filters)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
 
-	user := app.authenticatedUser(r)
 	var articles []*data.Article
 	var metaData data.Metadata
 
 	if user == nil {
-		articles, metaData, err = app.models.Articles.Articles(filters)
+		articles, metaData, err = app.models.Articles.Articles(r.Context(), filters)
 	} else {
-		articles, metaData, err = app.models.Articles.SubscribedArticles(filters, user)
+		articles, metaData, err = app.models.Articles.SubscribedArticles(r.Context(), filters, user, app.config.feed.trending)
 	}
 
 	if err == data.ErrRecordNotFound {
@@ -45,36 +84,46 @@ func (app *application) handleShowHomePage(w http.ResponseWriter, r *http.Reques
 		app.serverError(w, err)
 		return
 	}
-	pubs, err := app.models.Publications.ArticlePublications(articles)
-	if err != nil {
-		app.serverError(w, err)
-		return
+
+	var bookmarks []*data.Article
+	if user != nil {
+		bookmarks, _, err = app.models.Bookmarks.ForUser(r.Context(), user, data.Filters{Page: 1, PageSize: 3})
+		if err != nil {
+			app.serverError(w, err)
+			return
+		}
 	}
-	writers, err := app.models.Users.ArticleWriters(articles)
+
+	// bookmarked articles are shown alongside the feed, so they need
+	// their publications and writers too
+	listed := append(append([]*data.Article{}, articles...), bookmarks...)
+
+	pubs, err := app.loader(r).articlePublications(listed)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
-
-	likeMap, err := app.models.Articles.LikesMany(articles, user)
+	writers, err := app.loader(r).articleWriters(listed)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	commentCountMap, err := app.models.Comments.Counts(articles)
+	likeMap, err := app.models.Articles.LikesMany(r.Context(), articles, user)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
 	app.render(w, r, "home.page.gohtml", &templateData{
-		Articles:        articles,
-		Metadata:        metaData,
-		PubMap:          pubs,
-		UserMap:         writers,
-		LikeMap:         likeMap,
-		CommentCountMap: commentCountMap,
+		Articles:  articles,
+		Bookmarks: bookmarks,
+		Metadata:  metaData,
+		PubMap:    pubs,
+		UserMap:   writers,
+		LikeMap:   likeMap,
+		Sort:      sort,
+		Period:    period,
 	})
 }
 
@@ -93,36 +142,7 @@ func (app *application) handleRender(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.Write(app.markdownToHTML(form.Get("content")))
-}
-
-func (app *application) handleGetImage(w http.ResponseWriter, r *http.Request) {
-	imageStr := chi.URLParam(r, "imageID")
-	if imageStr == "" {
-		app.clientError(w, http.StatusNotFound)
-		return
-	}
-
-	imageID, err := strconv.Atoi(imageStr)
-	if err != nil {
-		app.clientError(w, http.StatusNotFound)
-		return
-	}
-
-	image, err := app.models.Images.Get(imageID)
-	if err == data.ErrRecordNotFound {
-		app.clientError(w, http.StatusNotFound)
-		return
-	} else if err != nil {
-		app.serverError(w, err)
-		return
-	}
-
-	w.Write(image)
-}
-
-func (app *application) handleGetDefaultImage(w http.ResponseWriter, r *http.Request) {
-	http.Redirect(w, r, "/static/img/default.png", http.StatusSeeOther)
+	w.Write(app.markdown.Render(r.Context(), form.Get("content"), markdown.Options{Tables: true}))
 }
 
 func (app *application) handleLikeArticleHome(w http.ResponseWriter, r *http.Request) {
@@ -140,23 +160,8 @@ func (app *application) handleLikeArticleHome(w http.ResponseWriter, r *http.Req
 	}
 
 	form := forms.New(r.PostForm)
-	form.Required("page")
 
-	if !form.Valid() {
-		if form.Errors.Has("page") {
-			app.session.Put(r, "flash_error", form.Errors.Get("page"))
-		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-
-	page, err := strconv.Atoi(form.Get("page"))
-	if err != nil {
-		app.clientError(w, http.StatusNotFound)
-		return
-	}
-
-	article, err := app.models.Articles.Get(articleID)
+	article, err := app.models.Articles.Get(r.Context(), articleID)
 	if err == data.ErrRecordNotFound {
 		app.clientError(w, http.StatusNotFound)
 		return
@@ -165,19 +170,21 @@ func (app *application) handleLikeArticleHome(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.likeArticle(w, user, article)
+	like, err := app.likeArticle(w, r, user, article)
 	if err != nil {
 		return
 	}
 
 	r.URL.Path = "/"
-	if page != 1 {
-		values := r.URL.Query()
-		values.Add("p", strconv.Itoa(page))
-		r.URL.RawQuery = values.Encode()
+	values := r.URL.Query()
+	for _, key := range []string{"sort", "t", "p", "cursor"} {
+		if form.Get(key) != "" {
+			values.Add(key, form.Get(key))
+		}
 	}
+	r.URL.RawQuery = values.Encode()
 
-	http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+	app.respondLike(w, r, like, r.URL.String())
 }
 
 func (app *application) handleUnlikeArticleHome(w http.ResponseWriter, r *http.Request) {
@@ -196,23 +203,8 @@ func (app *application) handleUnlikeArticleHome(w http.ResponseWriter, r *http.R
 	}
 
 	form := forms.New(r.PostForm)
-	form.Required("page")
-
-	if !form.Valid() {
-		if form.Errors.Has("page") {
-			app.session.Put(r, "flash_error", form.Errors.Get("page"))
-		}
-		http.Redirect(w, r, "/", http.StatusSeeOther)
-		return
-	}
-
-	page, err := strconv.Atoi(form.Get("page"))
-	if err != nil {
-		app.clientError(w, http.StatusNotFound)
-		return
-	}
 
-	article, err := app.models.Articles.Get(articleID)
+	article, err := app.models.Articles.Get(r.Context(), articleID)
 	if err == data.ErrRecordNotFound {
 		app.clientError(w, http.StatusNotFound)
 		return
@@ -221,17 +213,19 @@ func (app *application) handleUnlikeArticleHome(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.unlikeArticle(w, user, article)
+	like, err := app.unlikeArticle(w, r, user, article)
 	if err != nil {
 		return
 	}
 
 	r.URL.Path = "/"
-	if page != 1 {
-		values := r.URL.Query()
-		values.Add("p", strconv.Itoa(page))
-		r.URL.RawQuery = values.Encode()
+	values := r.URL.Query()
+	for _, key := range []string{"sort", "t", "p", "cursor"} {
+		if form.Get(key) != "" {
+			values.Add(key, form.Get(key))
+		}
 	}
+	r.URL.RawQuery = values.Encode()
 
-	http.Redirect(w, r, r.URL.String(), http.StatusSeeOther)
+	app.respondLike(w, r, like, r.URL.String())
 }
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/justinas/nosurf"
+	"html/template"
+	"net/http"
+	"strings"
+)
+
+// cachedPage is a page rendered for an anonymous request. Its body holds the
+// CSRF token of that request, which is swapped for the token of the request
+// the page is served to.
+type cachedPage struct {
+	header http.Header
+	body   []byte
+	token  string
+}
+
+// cachedHeaders are the headers kept along with the body of a cached page.
+var cachedHeaders = []string{"Content-Type", "Cache-Control", "Vary", "ETag", "Last-Modified"}
+
+var attrTemplate = template.Must(template.New("attr").Parse(`<p title='{{.}}'>`))
+
+// escapeAttr escapes s the way it appears in attribute values rendered by
+// html/template.
+func escapeAttr(s string) string {
+	var b strings.Builder
+	attrTemplate.Execute(&b, s)
+	return strings.TrimSuffix(strings.TrimPrefix(b.String(), "<p title='"), "'>")
+}
+
+// isAnonymousView reports whether the request is an anonymous page view,
+// whose response is the same for every visitor. Pages with a flash message
+// aren't, as the message is shown only once.
+func (app *application) isAnonymousView(r *http.Request) bool {
+	return r.Method == http.MethodGet &&
+		app.authenticatedUser(r) == nil &&
+		!app.session.Exists(r, "flash") &&
+		!app.session.Exists(r, "flash_error")
+}
+
+// setCacheControl sets the caching policy of a page. Pages of logged-in users
+// and pages showing a flash message must not be stored at all, not even by
+// the browser, as they hold personal data or are shown only once. Anonymous
+// pages still depend on the session cookie through their CSRF token, so only
+// browsers may keep them, revalidating them cheaply each time with their
+// ETag and Last-Modified.
+func (app *application) setCacheControl(w http.ResponseWriter, r *http.Request) {
+	if !app.isAnonymousView(r) {
+		w.Header().Set("Cache-Control", "private, no-store")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("Vary", "Cookie")
+}
+
+// etag turns the tag of some data into an entity tag. Tags are weak, as the
+// pages also carry a CSRF token of their own, and change with every release
+// as the templates may have.
+func etag(tag string) string {
+	sum := sha256.Sum256([]byte(version + buildTime + tag))
+	return `W/"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// notModified validates the copy an anonymous client has of a page against
+// the freshness of its data. It sets the validators of the page and, if the
+// copy is still fresh, writes a 304 response and returns true.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, freshness func() (*data.Freshness, error)) bool {
+	if !app.isAnonymousView(r) {
+		return false
+	}
+
+	f, err := freshness()
+	if err != nil {
+		app.errorLog.Print(err)
+		return false
+	}
+
+	w.Header().Set("ETag", etag(f.Tag))
+	w.Header().Set("Last-Modified", f.LastModified.UTC().Format(http.TimeFormat))
+
+	return app.checkNotModified(w, r)
+}
+
+// checkNotModified compares the validators already set on the response with
+// the conditional headers of the request, writing a 304 response and
+// returning true if they match.
+func (app *application) checkNotModified(w http.ResponseWriter, r *http.Request) bool {
+	if !isFresh(r, w.Header()) {
+		return false
+	}
+
+	app.setCacheControl(w, r)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+func isFresh(r *http.Request, header http.Header) bool {
+	// an entity tag decides alone, it catches the changes that leave no
+	// timestamp behind
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		tag := strings.TrimPrefix(header.Get("ETag"), "W/")
+		if tag == "" {
+			return false
+		}
+		for _, m := range strings.Split(match, ",") {
+			m = strings.TrimPrefix(strings.TrimSpace(m), "W/")
+			if m == tag || m == "*" {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return false
+	}
+
+	return !modified.After(since)
+}
+
+// pageRecorder passes a response through while keeping a copy of it.
+type pageRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *pageRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *pageRecorder) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// microCache serves anonymous page views from a copy of the page rendered
+// for an earlier view in the last few seconds, so that bursts of readers
+// coming for the same page are rendered once.
+func (app *application) microCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.isAnonymousView(r) || nosurf.Token(r) == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		key := r.URL.RequestURI()
+		token := escapeAttr(nosurf.Token(r))
+
+		if page, ok := app.cache.pages.Get(key); ok {
+			for k, v := range page.header {
+				w.Header()[k] = v
+			}
+			if app.checkNotModified(w, r) {
+				return
+			}
+			w.Write(bytes.ReplaceAll(page.body, []byte(page.token), []byte(token)))
+			return
+		}
+
+		rec := &pageRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		if rec.status != http.StatusOK {
+			return
+		}
+
+		page := cachedPage{header: make(http.Header), body: rec.body.Bytes(), token: token}
+		for _, k := range cachedHeaders {
+			if v := w.Header().Values(k); len(v) > 0 {
+				page.header[k] = v
+			}
+		}
+		app.cache.pages.Set(key, page)
+	})
+}
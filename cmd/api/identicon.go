@@ -0,0 +1,128 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"net/http"
+)
+
+// identiconBackground is the colour around the cells of identicons.
+var identiconBackground = color.RGBA{R: 0xf0, G: 0xf0, B: 0xf0, A: 0xff}
+
+// identiconSeed names the identicon of a user without a picture. It is
+// derived from the id and the name, so that people with the same name look
+// different, and a new name gets a new identicon under a new URL.
+func identiconSeed(user *data.User) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d:%s", user.ID, user.Name)))
+	return hex.EncodeToString(sum[:8])
+}
+
+func identiconURL(seed string, size int) string {
+	return fmt.Sprintf("/img/identicon/%s-%d.png", seed, size)
+}
+
+// handleGetIdenticon serves the identicon of the seed. Identicons are drawn
+// from the seed alone, so they need no lookups and never change.
+func (app *application) handleGetIdenticon(w http.ResponseWriter, r *http.Request) {
+	seed := chi.URLParam(r, "seed")
+
+	size, ok := imageSize(r)
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	app.writeImage(w, r, fmt.Sprintf("%s-%d", seed, size), func() (cachedImage, error) {
+		key := "identicon/" + seed + "-" + fmt.Sprint(size)
+		if img, ok := app.cache.images.Get(key); ok {
+			return img, nil
+		}
+
+		b, err := hex.DecodeString(seed)
+		if err != nil {
+			return cachedImage{}, data.ErrRecordNotFound
+		}
+
+		buf := new(bytes.Buffer)
+		err = png.Encode(buf, drawIdenticon(b, size))
+		if err != nil {
+			return cachedImage{}, err
+		}
+
+		img := cachedImage{content: buf.Bytes(), contentType: "image/png"}
+		app.cache.images.Set(key, img)
+		return img, nil
+	})
+}
+
+// drawIdenticon draws a symmetric five by five pattern of cells in a colour,
+// both taken from the seed, with a margin of half a cell around it.
+func drawIdenticon(seed []byte, size int) image.Image {
+	hue := float64(int(seed[0])<<8|int(seed[1])) / 65536 * 360
+	fg := hslToRGB(hue, 0.55, 0.55)
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Rect, image.NewUniform(identiconBackground), image.Point{}, draw.Src)
+
+	cell := float64(size) / 6
+	margin := cell / 2
+
+	// the left three columns come from the seed, the right two mirror them
+	bits := uint(seed[2])<<8 | uint(seed[3])
+	for row := 0; row < 5; row++ {
+		for col := 0; col < 3; col++ {
+			if bits&(1<<(row*3+col)) == 0 {
+				continue
+			}
+			for _, c := range []int{col, 4 - col} {
+				x0 := int(math.Round(margin + float64(c)*cell))
+				y0 := int(math.Round(margin + float64(row)*cell))
+				x1 := int(math.Round(margin + float64(c+1)*cell))
+				y1 := int(math.Round(margin + float64(row+1)*cell))
+				draw.Draw(img, image.Rect(x0, y0, x1, y1), image.NewUniform(fg), image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return img
+}
+
+// hslToRGB converts a colour given by hue in degrees, saturation and
+// lightness.
+func hslToRGB(h, s, l float64) color.RGBA {
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(h/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case h < 60:
+		r, g, b = c, x, 0
+	case h < 120:
+		r, g, b = x, c, 0
+	case h < 180:
+		r, g, b = 0, c, x
+	case h < 240:
+		r, g, b = 0, x, c
+	case h < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 0xff,
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"blogalusta/internal/storage"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"image"
+	"image/jpeg"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imageSizes are the side lengths images are served in.
+var imageSizes = []int{48, 96, 256}
+
+// immutable is the caching policy of responses that never change.
+const immutable = "public, max-age=31536000, immutable"
+
+// variantType is the content type of the images resized to the image sizes,
+// whatever the type of their original.
+const variantType = "image/jpeg"
+
+// cachedImage is the content of an image along with its content type.
+type cachedImage struct {
+	content     []byte
+	contentType string
+}
+
+// originalImageURL returns the content-hash URL of the image as it was
+// stored.
+func originalImageURL(hash string) string {
+	return fmt.Sprintf("/img/%s.jpg", hash)
+}
+
+// imageMarkdown returns the Markdown showing the image with the alt text.
+func imageMarkdown(alt, hash string) string {
+	alt = strings.NewReplacer(`\`, `\\`, "[", `\[`, "]", `\]`).Replace(alt)
+	return fmt.Sprintf("![%s](%s)", alt, originalImageURL(hash))
+}
+
+// imageURL returns the content-hash URL of the image in the size.
+func imageURL(hash string, size int) string {
+	return fmt.Sprintf("/img/%s-%d.jpg", hash, size)
+}
+
+// sizeFor returns the smallest image size that is still sharp when shown
+// width pixels wide on high density screens.
+func sizeFor(width int) int {
+	for _, size := range imageSizes {
+		if size >= 2*width {
+			return size
+		}
+	}
+	return imageSizes[len(imageSizes)-1]
+}
+
+// imageSize returns the image size for the size URL parameter, the largest
+// one if there is none.
+func imageSize(r *http.Request) (int, bool) {
+	param := chi.URLParam(r, "size")
+	if param == "" {
+		return imageSizes[len(imageSizes)-1], true
+	}
+
+	size, err := strconv.Atoi(param)
+	if err != nil {
+		return 0, false
+	}
+	for _, s := range imageSizes {
+		if s == size {
+			return size, true
+		}
+	}
+
+	return 0, false
+}
+
+// handleRedirectImage sends the URL of an image by id to its content-hash
+// URL. Images never change, so neither does the redirect.
+func (app *application) handleRedirectImage(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "imageID"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	size, ok := imageSize(r)
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	hash, ok := app.cache.imageHashes.Get(id)
+	if !ok {
+		hash, err = app.models.Images.Hash(r.Context(), id)
+		if err == data.ErrRecordNotFound {
+			app.clientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+		app.cache.imageHashes.Set(id, hash)
+	}
+
+	w.Header().Set("Cache-Control", immutable)
+	http.Redirect(w, r, imageURL(hash, size), http.StatusMovedPermanently)
+}
+
+func (app *application) handleGetImage(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+
+	size, ok := imageSize(r)
+	if !ok {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	app.writeImage(w, r, fmt.Sprintf("%s-%d", hash, size), func() (cachedImage, error) {
+		return app.imageVariant(r.Context(), hash, size)
+	})
+}
+
+// handleGetOriginalImage serves an image as it was stored, in the content
+// type it was uploaded in, the way article images are shown.
+func (app *application) handleGetOriginalImage(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+
+	app.writeImage(w, r, hash, func() (cachedImage, error) {
+		return app.originalImage(r.Context(), hash)
+	})
+}
+
+// writeImage writes the image returned by load, or a 304 response if the
+// client already has the image tagged tag. The content of an image URL
+// never changes, so clients may keep it for good.
+func (app *application) writeImage(w http.ResponseWriter, r *http.Request, tag string, load func() (cachedImage, error)) {
+	w.Header().Set("Cache-Control", immutable)
+	w.Header().Set("ETag", `"`+tag+`"`)
+	if isFresh(r, w.Header()) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	img, err := load()
+	if err == data.ErrRecordNotFound {
+		w.Header().Del("Cache-Control")
+		app.clientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		w.Header().Del("Cache-Control")
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", img.contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(img.content)))
+	w.Write(img.content)
+}
+
+func (app *application) handleGetDefaultImage(w http.ResponseWriter, r *http.Request) {
+	http.Redirect(w, r, "/static/img/default.png", http.StatusMovedPermanently)
+}
+
+// imageVariant returns the image with the content hash resized to size,
+// generating the variant from the original the first time it is asked for.
+func (app *application) imageVariant(ctx context.Context, hash string, size int) (cachedImage, error) {
+	key := data.VariantKey(hash, size, variantType)
+	if img, ok := app.cache.images.Get(key); ok {
+		return img, nil
+	}
+
+	content, err := app.images.Get(ctx, key)
+	if err == storage.ErrNotFound {
+		content, err = app.generateVariant(ctx, hash, size)
+	}
+	if err != nil {
+		return cachedImage{}, err
+	}
+
+	img := cachedImage{content: content, contentType: variantType}
+	app.cache.images.Set(key, img)
+	return img, nil
+}
+
+// originalImage returns the image with the content hash as it was stored.
+func (app *application) originalImage(ctx context.Context, hash string) (cachedImage, error) {
+	if img, ok := app.cache.images.Get(data.ImageKey(hash)); ok {
+		return img, nil
+	}
+
+	record, err := app.models.Images.GetByHash(ctx, hash)
+	if err != nil {
+		return cachedImage{}, err
+	}
+
+	return app.originalOf(ctx, record)
+}
+
+// originalOf returns the content of the image record. Images uploaded
+// before blob storage are read from the database until they are moved.
+func (app *application) originalOf(ctx context.Context, record *data.Image) (cachedImage, error) {
+	key := data.ImageKey(record.Hash)
+	if img, ok := app.cache.images.Get(key); ok {
+		return img, nil
+	}
+
+	content := record.Data
+	if content == nil {
+		var err error
+		content, err = app.images.Get(ctx, key)
+		if err == storage.ErrNotFound {
+			return cachedImage{}, data.ErrRecordNotFound
+		} else if err != nil {
+			return cachedImage{}, err
+		}
+	}
+
+	img := cachedImage{content: content, contentType: record.ContentType}
+	app.cache.images.Set(key, img)
+	return img, nil
+}
+
+func (app *application) generateVariant(ctx context.Context, hash string, size int) ([]byte, error) {
+	original, err := app.models.Images.GetByHash(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := app.originalOf(ctx, original)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(content.content))
+	if err != nil {
+		return nil, err
+	}
+
+	img = cropCenterResize(img, size)
+
+	buf := new(bytes.Buffer)
+	err = jpeg.Encode(buf, img, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// the variant can be generated again if storing it fails
+	err = app.images.Put(ctx, data.VariantKey(hash, size, variantType), buf.Bytes(), variantType)
+	if err != nil {
+		app.errorLog.Print(err)
+		return buf.Bytes(), nil
+	}
+	err = app.models.Images.InsertVariant(ctx, original, size, variantType, buf.Len())
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// storeImage records an uploaded image and puts it in blob storage, or finds
+// the image already stored with the same content. The record goes first so
+// that the sweeper, which deletes blobs while holding the record, never
+// deletes the blob of an upload in progress. A record whose blob failed to
+// be stored has no references and is swept later.
+func (app *application) storeImage(ctx context.Context, content []byte, contentType string, img image.Image, owner *data.User) (*data.Image, error) {
+	sum := sha256.Sum256(content)
+
+	record := &data.Image{
+		Hash:        hex.EncodeToString(sum[:]),
+		ContentType: contentType,
+		Width:       img.Bounds().Dx(),
+		Height:      img.Bounds().Dy(),
+		Size:        len(content),
+		OwnerID:     sql.NullInt64{Int64: int64(owner.ID), Valid: true},
+	}
+	err := app.models.Images.Insert(ctx, record)
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.images.Put(ctx, data.ImageKey(record.Hash), content, contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// sweepImages keeps deleting the images nothing refers to anymore, like the
+// pictures users replaced, once they are older than the grace period.
+func (app *application) sweepImages(interval, grace, timeout time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		deleted, err := app.sweepImageBatches(context.Background(), grace, timeout)
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+		if deleted > 0 {
+			app.infoLog.Printf("deleted %d unreferenced images\n", deleted)
+		}
+	}
+}
+
+// sweepBatch is the number of images deleted in one transaction, which
+// also deletes their blobs. It is kept small so that a batch holds its
+// locks briefly and fits in its deadline.
+const sweepBatch = 5
+
+// sweepImageBatches deletes the unreferenced images batch by batch, each
+// under the timeout of the sweep.
+func (app *application) sweepImageBatches(ctx context.Context, grace, timeout time.Duration) (int, error) {
+	deleted := 0
+	for {
+		images, err := app.sweepImageBatch(ctx, grace, timeout)
+		if err != nil {
+			return deleted, err
+		}
+
+		for _, image := range images {
+			app.cache.imageHashes.Delete(image.ID)
+			app.cache.images.Delete(data.ImageKey(image.Hash))
+			for _, size := range imageSizes {
+				app.cache.images.Delete(data.VariantKey(image.Hash, size, variantType))
+			}
+		}
+
+		deleted += len(images)
+		if len(images) < sweepBatch {
+			return deleted, nil
+		}
+	}
+}
+
+func (app *application) sweepImageBatch(ctx context.Context, grace, timeout time.Duration) ([]*data.Image, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	return app.models.Images.DeleteUnreferenced(ctx, grace, sweepBatch,
+		func(image *data.Image, variants []*data.ImageVariant) error {
+			for _, v := range variants {
+				err := app.images.Delete(ctx, data.VariantKey(v.Hash, v.Size, v.ContentType))
+				if err != nil {
+					return err
+				}
+			}
+			return app.images.Delete(ctx, data.ImageKey(image.Hash))
+		})
+}
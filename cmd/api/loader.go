@@ -0,0 +1,233 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"context"
+	"net/http"
+)
+
+// loader memoises the users, publications and memberships looked up while
+// handling a request, so that middlewares, handlers and templates can all ask
+// for them without hitting the database again. Lists of ids are fetched in a
+// single query. A loader lives as long as its request and, like the request,
+// is not safe for concurrent use.
+type loader struct {
+	app *application
+	ctx context.Context
+
+	users        map[int]*data.User
+	publications map[int]*data.Publication
+	writers      map[int][]*data.User
+	pending      map[int][]*data.User
+	subscribed   map[[2]int]bool
+
+	hasPublications map[int]bool
+	hasInvitations  map[int]bool
+	unread          map[int]int
+}
+
+func newLoader(app *application, ctx context.Context) *loader {
+	return &loader{
+		app:             app,
+		ctx:             ctx,
+		users:           make(map[int]*data.User),
+		publications:    make(map[int]*data.Publication),
+		writers:         make(map[int][]*data.User),
+		pending:         make(map[int][]*data.User),
+		subscribed:      make(map[[2]int]bool),
+		hasPublications: make(map[int]bool),
+		hasInvitations:  make(map[int]bool),
+		unread:          make(map[int]int),
+	}
+}
+
+// memoise returns the value stored under the key, calling load to fill it in
+// the first time.
+func memoise[K comparable, V any](m map[K]V, key K, load func() (V, error)) (V, error) {
+	if v, ok := m[key]; ok {
+		return v, nil
+	}
+
+	v, err := load()
+	if err != nil {
+		return v, err
+	}
+	m[key] = v
+
+	return v, nil
+}
+
+// loader returns the loader of the request, or a fresh one for requests that
+// didn't go through loadRequest.
+func (app *application) loader(r *http.Request) *loader {
+	l, ok := r.Context().Value(contextKeyLoader).(*loader)
+	if !ok {
+		return newLoader(app, r.Context())
+	}
+	return l
+}
+
+// prime stores users that have been fetched elsewhere.
+func (l *loader) prime(users ...*data.User) {
+	for _, u := range users {
+		l.users[u.ID] = u
+	}
+}
+
+func (l *loader) user(id int) (*data.User, error) {
+	return memoise(l.users, id, func() (*data.User, error) {
+		return l.app.userByID(l.ctx, id)
+	})
+}
+
+// usersByID returns the users with the ids, fetching the ones not seen yet
+// in a single query.
+func (l *loader) usersByID(ids []int) (map[int]*data.User, error) {
+	var missing []int
+	for _, id := range ids {
+		if _, ok := l.users[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		users, err := l.app.models.Users.GetMany(l.ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for id, u := range users {
+			l.users[id] = u
+		}
+	}
+
+	users := make(map[int]*data.User, len(ids))
+	for _, id := range ids {
+		if u, ok := l.users[id]; ok {
+			users[id] = u
+		}
+	}
+
+	return users, nil
+}
+
+// publicationsByID returns the publications with the ids, fetching the ones
+// not seen yet in a single query.
+func (l *loader) publicationsByID(ids []int) (map[int]*data.Publication, error) {
+	var missing []int
+	for _, id := range ids {
+		if _, ok := l.publications[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) > 0 {
+		pubs, err := l.app.models.Publications.GetMany(l.ctx, missing)
+		if err != nil {
+			return nil, err
+		}
+		for id, p := range pubs {
+			l.publications[id] = p
+		}
+	}
+
+	pubs := make(map[int]*data.Publication, len(ids))
+	for _, id := range ids {
+		if p, ok := l.publications[id]; ok {
+			pubs[id] = p
+		}
+	}
+
+	return pubs, nil
+}
+
+func (l *loader) articleWriters(articles []*data.Article) (map[int]*data.User, error) {
+	ids := make([]int, len(articles))
+	for i, a := range articles {
+		ids[i] = a.WriterID
+	}
+	return l.usersByID(ids)
+}
+
+func (l *loader) articlePublications(articles []*data.Article) (map[int]*data.Publication, error) {
+	ids := make([]int, len(articles))
+	for i, a := range articles {
+		ids[i] = a.PublicationID
+	}
+	return l.publicationsByID(ids)
+}
+
+func (l *loader) publicationOwners(publications []*data.Publication) (map[int]*data.User, error) {
+	ids := make([]int, len(publications))
+	for i, p := range publications {
+		ids[i] = p.OwnerID
+	}
+	return l.usersByID(ids)
+}
+
+func (l *loader) commenters(comments []*data.Comment) (map[int]*data.User, error) {
+	ids := make([]int, len(comments))
+	for i, c := range comments {
+		ids[i] = c.CommenterID
+	}
+	return l.usersByID(ids)
+}
+
+func (l *loader) publicationWriters(publication *data.Publication) ([]*data.User, error) {
+	return memoise(l.writers, publication.ID, func() ([]*data.User, error) {
+		writers, err := l.app.models.Users.GetWritersOfPublication(l.ctx, publication)
+		if err != nil {
+			return nil, err
+		}
+		l.prime(writers...)
+		return writers, nil
+	})
+}
+
+func (l *loader) invitedWriters(publication *data.Publication) ([]*data.User, error) {
+	return memoise(l.pending, publication.ID, func() ([]*data.User, error) {
+		return l.app.models.Publications.Invitations(l.ctx, publication)
+	})
+}
+
+// isWriter reports whether the user writes on the publication, going by its
+// list of writers.
+func (l *loader) isWriter(publication *data.Publication, user *data.User) (bool, error) {
+	if publication == nil || user == nil {
+		return false, nil
+	}
+
+	writers, err := l.publicationWriters(publication)
+	if err != nil {
+		return false, err
+	}
+
+	return userIn(user, writers), nil
+}
+
+func (l *loader) isSubscribed(publication *data.Publication, user *data.User) (bool, error) {
+	if publication == nil || user == nil {
+		return false, nil
+	}
+
+	return memoise(l.subscribed, [2]int{publication.ID, user.ID}, func() (bool, error) {
+		return l.app.models.Publications.UserIsSubscribed(l.ctx, publication, user)
+	})
+}
+
+func (l *loader) hasPublication(user *data.User) (bool, error) {
+	return memoise(l.hasPublications, user.ID, func() (bool, error) {
+		return l.app.models.Users.HasPublication(l.ctx, user)
+	})
+}
+
+func (l *loader) hasInvitation(user *data.User) (bool, error) {
+	return memoise(l.hasInvitations, user.ID, func() (bool, error) {
+		return l.app.models.Users.HasInvitations(l.ctx, user)
+	})
+}
+
+func (l *loader) unreadNotifications(user *data.User) (int, error) {
+	return memoise(l.unread, user.ID, func() (int, error) {
+		return l.app.models.Notifications.UnreadCount(l.ctx, user)
+	})
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"blogalusta/internal/data"
+	"blogalusta/internal/markdown"
+	"blogalusta/internal/storage"
 	"context"
 	"database/sql"
 	"flag"
@@ -10,8 +12,6 @@ import (
 	"github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/golangcollege/sessions"
-	"github.com/gomarkdown/markdown/html"
-	"github.com/microcosm-cc/bluemonday"
 	"html/template"
 	"log"
 	"net/http"
@@ -31,28 +31,65 @@ type contextKey string
 var (
 	contextKeyUser        = contextKey("user")
 	contextKeyPublication = contextKey("publication")
-	contextKeyWriters     = contextKey("writers")
-	contextKeyPending     = contextKey("pending")
 	contextKeyArticle     = contextKey("article")
 	contextKeyProfile     = contextKey("profileUser")
 	contextKeyComment     = contextKey("comment")
+	contextKeyReadingList = contextKey("readingList")
+	contextKeyLoader      = contextKey("loader")
 )
 
 type config struct {
 	port    int
+	baseURL string
 	useHsts bool
+	secret  string
+	debug   bool
 
 	db struct {
 		dsn          string
 		maxOpenConns int
 		maxIdleConns int
 		maxIdleTime  string
+		timeout      time.Duration
+		slowQuery    time.Duration
 	}
 
+	imageMaxPixels int
+
 	avatar struct {
 		maxSize    int
 		sideLength int
 	}
+
+	articleImage struct {
+		maxSize  int
+		maxWidth int
+	}
+
+	imageGC struct {
+		interval time.Duration
+		grace    time.Duration
+		timeout  time.Duration
+	}
+
+	storage storage.Config
+
+	http struct {
+		pageCacheTTL time.Duration
+	}
+
+	cache struct {
+		size       int
+		imageBytes int
+		ttl        time.Duration
+		notify     bool
+	}
+
+	feed struct {
+		pageSize int
+		trending int
+		refresh  time.Duration
+	}
 }
 
 type application struct {
@@ -62,28 +99,59 @@ type application struct {
 	models        data.Models
 	session       *sessions.Session
 	templateCache map[string]*template.Template
-	markdown      struct {
-		policy   *bluemonday.Policy
-		renderer *html.Renderer
-	}
+	events        *broker
+	cache         *caches
+	images        storage.Store
+	markdown      *markdown.Pipeline
 }
 
 func main() {
 	var cfg config
 
 	flag.IntVar(&cfg.port, "port", getEnvInt("PORT", 4000), "API server port")
+	flag.StringVar(&cfg.baseURL, "base-url", getEnvString("BASE_URL", "http://localhost:4000"), "URL the site is served at, for links shared out of it")
 	flag.StringVar(&cfg.db.dsn, "db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
-	secret := flag.String("secret", os.Getenv("SESSION_SECRET"), "Session secret key")
+	flag.StringVar(&cfg.secret, "secret", os.Getenv("SESSION_SECRET"), "Session and cursor secret key")
 	flag.BoolVar(&cfg.useHsts, "hsts", getEnvBool("USE_HSTS", false), "Upgrade to https automatically")
+	flag.BoolVar(&cfg.debug, "debug", getEnvBool("DEBUG", false), "Report the number of queries run for each request")
 
 	// Heroku free DB has max 20 connections
 	flag.IntVar(&cfg.db.maxOpenConns, "db-max-open-conns", 20, "PostgreSQL max open connections")
 	flag.IntVar(&cfg.db.maxIdleConns, "db-max-idle-conns", 20, "PostgreSQL max idle connections")
 	flag.StringVar(&cfg.db.maxIdleTime, "db-max-idle-time", "15m", "PostgreSQL max connection idle time")
+	flag.DurationVar(&cfg.db.timeout, "db-timeout", 3*time.Second, "PostgreSQL query timeout")
+	flag.DurationVar(&cfg.db.slowQuery, "db-slow-query", 500*time.Millisecond, "Log PostgreSQL queries slower than this, 0 to disable")
 
+	flag.IntVar(&cfg.imageMaxPixels, "image-max-pixels", 40_000_000, "Pixel count uploaded images may decode to")
 	flag.IntVar(&cfg.avatar.maxSize, "avatar-max-size", 1024*1024, "Avatar max size")
 	flag.IntVar(&cfg.avatar.sideLength, "avatar-side-length", 256, "Avatar size length")
 
+	flag.IntVar(&cfg.articleImage.maxSize, "article-image-max-size", 5*1024*1024, "Article image max size")
+	flag.IntVar(&cfg.articleImage.maxWidth, "article-image-max-width", 1400, "Width article images are scaled down to")
+
+	flag.DurationVar(&cfg.imageGC.interval, "image-gc-interval", time.Hour, "Interval of deleting unreferenced images, 0 to disable")
+	flag.DurationVar(&cfg.imageGC.grace, "image-gc-grace", 24*time.Hour, "How long unreferenced images are kept")
+	flag.DurationVar(&cfg.imageGC.timeout, "image-gc-timeout", time.Minute, "Deadline of deleting a batch of unreferenced images and their blobs")
+
+	flag.StringVar(&cfg.storage.Backend, "storage", getEnvString("STORAGE", "fs"), "Image storage backend (fs|s3)")
+	flag.StringVar(&cfg.storage.Dir, "storage-dir", getEnvString("STORAGE_DIR", "./blobs"), "Image storage directory of the fs backend")
+	flag.StringVar(&cfg.storage.S3.Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "S3 compatible service URL")
+	flag.StringVar(&cfg.storage.S3.Region, "s3-region", getEnvString("S3_REGION", "us-east-1"), "S3 region")
+	flag.StringVar(&cfg.storage.S3.Bucket, "s3-bucket", os.Getenv("S3_BUCKET"), "S3 bucket")
+	flag.StringVar(&cfg.storage.S3.AccessKey, "s3-access-key", os.Getenv("S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.storage.S3.SecretKey, "s3-secret-key", os.Getenv("S3_SECRET_KEY"), "S3 secret key")
+
+	flag.IntVar(&cfg.feed.pageSize, "feed-page-size", 10, "Home feed articles per page")
+	flag.IntVar(&cfg.feed.trending, "feed-trending", 5, "Trending articles blended into the home feed")
+	flag.DurationVar(&cfg.feed.refresh, "feed-trending-refresh", time.Minute, "Interval of refreshing the trending scores")
+
+	flag.IntVar(&cfg.cache.size, "cache-size", 1000, "Entries kept in each in-process cache")
+	flag.IntVar(&cfg.cache.imageBytes, "image-cache-bytes", 64<<20, "Bytes of images kept in the in-process image cache")
+	flag.DurationVar(&cfg.cache.ttl, "cache-ttl", 5*time.Minute, "Time to live of the cache entries")
+	flag.BoolVar(&cfg.cache.notify, "cache-notify", getEnvBool("CACHE_NOTIFY", true), "Invalidate the caches of the other instances through PostgreSQL NOTIFY")
+
+	flag.DurationVar(&cfg.http.pageCacheTTL, "page-cache-ttl", 5*time.Second, "How long anonymous pages are served from the page cache, 0 to disable")
+
 	displayVersion := flag.Bool("version", false, "Display version and exit")
 
 	flag.Parse()
@@ -108,31 +176,40 @@ func main() {
 	}
 	defer db.Close()
 
-	session := sessions.New([]byte(*secret))
+	images, err := storage.Open(cfg.storage)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	session := sessions.New([]byte(cfg.secret))
 	session.Lifetime = 24 * time.Hour
 	session.Secure = true
 	session.SameSite = http.SameSiteStrictMode
 
-	htmlFlags := html.CommonFlags | html.HrefTargetBlank
-	opts := html.RendererOptions{Flags: htmlFlags}
-
-	renderer := html.NewRenderer(opts)
+	dataDB := &data.DB{
+		DB:        db,
+		Timeout:   cfg.db.timeout,
+		SlowQuery: cfg.db.slowQuery,
+		Logger:    infoLog,
+	}
 
 	app := &application{
 		config:        cfg,
 		infoLog:       infoLog,
 		errorLog:      errorLog,
-		models:        data.NewModels(db),
+		models:        data.NewModels(dataDB),
 		templateCache: templateCache,
 		session:       session,
-		markdown: struct {
-			policy   *bluemonday.Policy
-			renderer *html.Renderer
-		}{
-			policy:   bluemonday.UGCPolicy(),
-			renderer: renderer,
-		},
+		events:        newBroker(),
+		cache:         newCaches(cfg, dataDB),
+		images:        images,
+		markdown:      markdown.New(),
 	}
+	app.markdown.Embeds["article"] = app.articleEmbed()
+
+	go app.listenEvents(cfg.db.dsn)
+	go app.refreshTrending(cfg.feed.refresh)
+	go app.sweepImages(cfg.imageGC.interval, cfg.imageGC.grace, cfg.imageGC.timeout)
 
 	infoLog.Printf("starting server on port %d\n", app.config.port)
 	if app.config.useHsts {
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"blogalusta/internal/markdown"
+	"regexp"
+	"strings"
+)
+
+// markdownFeature is an extension of Markdown as the settings of a
+// publication show it.
+type markdownFeature struct {
+	markdown.Feature
+	Enabled bool
+}
+
+// markdownFeatureOptions returns the extensions there are, marking the ones
+// enabled.
+func markdownFeatureOptions(enabled []string) []markdownFeature {
+	options := make([]markdownFeature, len(markdown.Features))
+	for i, f := range markdown.Features {
+		options[i] = markdownFeature{Feature: f}
+		for _, name := range enabled {
+			if name == f.Name {
+				options[i].Enabled = true
+			}
+		}
+	}
+	return options
+}
+
+// maxFrameHosts bounds the hosts a publication can take iframes from.
+const maxFrameHosts = 10
+
+var frameHost = regexp.MustCompile(`^[a-z0-9-]+(\.[a-z0-9-]+)+$`)
+
+// parseFrameHosts returns the hosts listed one per line or separated by
+// spaces, lowercased and without duplicates, and the first that isn't a
+// host name.
+func parseFrameHosts(s string) ([]string, string) {
+	hosts := []string{}
+	seen := map[string]bool{}
+	for _, host := range strings.Fields(strings.ToLower(s)) {
+		if !frameHost.MatchString(host) {
+			return nil, host
+		}
+		if !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, ""
+}
+
+// markdownOptions returns how the articles of the publication render.
+func markdownOptions(publication *data.Publication) markdown.Options {
+	return markdown.Options{
+		Features:   publication.MarkdownFeatures,
+		Tables:     publication.AllowTables,
+		FrameHosts: publication.FrameHosts,
+	}
+}
@@ -48,6 +48,28 @@ func (app *application) recoverPanic(next http.Handler) http.Handler {
 	})
 }
 
+// countQueries sets the X-Query-Count header in debug mode. The queries are
+// counted by a counter in the context of the request, so only the queries
+// run for it are.
+func (app *application) countQueries(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.config.debug {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx, counter := data.WithQueryCounter(r.Context())
+		next.ServeHTTP(&queryCountWriter{ResponseWriter: w, counter: counter}, r.WithContext(ctx))
+	})
+}
+
+func (app *application) loadRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), contextKeyLoader, newLoader(app, r.Context()))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
 func (app *application) requireAuthenticatedUser(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if app.authenticatedUser(r) == nil {
@@ -78,7 +100,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.Get(app.session.GetInt(r, "userID"))
+		user, err := app.userByID(r.Context(), app.session.GetInt(r, "userID"))
 		if err == data.ErrRecordNotFound {
 			app.session.Remove(r, "userID")
 			next.ServeHTTP(w, r)
@@ -88,6 +110,8 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 			return
 		}
 
+		app.loader(r).prime(user)
+
 		ctx := context.WithValue(r.Context(), contextKeyUser, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -96,7 +120,7 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 func (app *application) addPublicationToContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		publicationSlug := chi.URLParam(r, "publicationSlug")
-		publication, err := app.models.Publications.GetBySlug(publicationSlug)
+		publication, err := app.publicationBySlug(r.Context(), publicationSlug)
 		if err == data.ErrRecordNotFound {
 			app.clientError(w, http.StatusNotFound)
 			return
@@ -105,21 +129,7 @@ func (app *application) addPublicationToContext(next http.Handler) http.Handler
 			return
 		}
 
-		writers, err := app.models.Users.GetWritersOfPublication(publication)
-		if err != nil {
-			app.serverError(w, err)
-			return
-		}
-
-		pending, err := app.models.Publications.Invitations(publication)
-		if err != nil {
-			app.serverError(w, err)
-			return
-		}
-
 		ctx := context.WithValue(r.Context(), contextKeyPublication, publication)
-		ctx = context.WithValue(ctx, contextKeyWriters, writers)
-		ctx = context.WithValue(ctx, contextKeyPending, pending)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -132,7 +142,7 @@ func (app *application) addArticleToContext(next http.Handler) http.Handler {
 			return
 		}
 
-		article, err := app.models.Articles.Get(id)
+		article, err := app.models.Articles.Get(r.Context(), id)
 		if err == data.ErrRecordNotFound {
 			app.clientError(w, http.StatusNotFound)
 			return
@@ -159,7 +169,7 @@ func (app *application) addProfileToContext(next http.Handler) http.Handler {
 			return
 		}
 
-		user, err := app.models.Users.Get(id)
+		user, err := app.userByID(r.Context(), id)
 		if err == data.ErrRecordNotFound {
 			app.clientError(w, http.StatusNotFound)
 			return
@@ -173,6 +183,8 @@ func (app *application) addProfileToContext(next http.Handler) http.Handler {
 			return
 		}
 
+		app.loader(r).prime(user)
+
 		ctx := context.WithValue(r.Context(), contextKeyProfile, user)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -180,7 +192,7 @@ func (app *application) addProfileToContext(next http.Handler) http.Handler {
 
 func (app *application) requireUserIsWriter(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		isWriter, err := app.models.Publications.UserIsWriter(app.publication(r), app.authenticatedUser(r))
+		isWriter, err := app.loader(r).isWriter(app.publication(r), app.authenticatedUser(r))
 		if !isWriter || err != nil {
 			app.clientError(w, http.StatusUnauthorized)
 			return
@@ -201,6 +213,39 @@ func (app *application) requireUserIsOwner(next http.Handler) http.Handler {
 	})
 }
 
+func (app *application) addReadingListToContext(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		listID, err := strconv.Atoi(chi.URLParam(r, "listID"))
+		if err != nil {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+
+		list, err := app.models.ReadingLists.Get(r.Context(), listID)
+		if err == data.ErrRecordNotFound {
+			app.clientError(w, http.StatusNotFound)
+			return
+		} else if err != nil {
+			app.serverError(w, err)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), contextKeyReadingList, list)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func (app *application) requireReadingListOwner(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if app.readingList(r).UserID != app.authenticatedUser(r).ID {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) addCommentToContext(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		commentID, err := strconv.Atoi(chi.URLParam(r, "commentID"))
@@ -208,7 +253,7 @@ func (app *application) addCommentToContext(next http.Handler) http.Handler {
 			app.clientError(w, http.StatusNotFound)
 			return
 		}
-		comment, err := app.models.Comments.Get(commentID)
+		comment, err := app.models.Comments.Get(r.Context(), commentID)
 		if err == data.ErrRecordNotFound {
 			app.clientError(w, http.StatusNotFound)
 			return
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+func (app *application) handleShowNotificationsPage(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	var err error
+	values := r.URL.Query()
+	if values.Has("p") {
+		page, err = strconv.Atoi(values.Get("p"))
+		if err != nil {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		if page < 1 {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+	}
+
+	var filters data.Filters
+	filters.Page = page
+	filters.PageSize = 20
+
+	notifications, metaData, err := app.models.Notifications.ForUser(r.Context(), app.authenticatedUser(r), filters)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "notifications.page.gohtml", &templateData{
+		Notifications: notifications,
+		Metadata:      metaData,
+	})
+}
+
+func (app *application) handleReadNotification(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	notification, err := app.models.Notifications.MarkRead(r.Context(), app.authenticatedUser(r), id)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, notification.URL(), http.StatusSeeOther)
+}
+
+func (app *application) handleReadAllNotifications(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Notifications.MarkAllRead(r.Context(), app.authenticatedUser(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/notifications", http.StatusSeeOther)
+}
+
+func (app *application) handleChangeNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	// unchecked checkboxes are not submitted at all
+	prefs := make(map[string]bool, len(data.NotificationTypes))
+	for _, kind := range data.NotificationTypes {
+		prefs[kind] = r.PostForm.Has(kind)
+	}
+
+	err = app.models.Notifications.SetPreferences(r.Context(), app.authenticatedUser(r), prefs)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Notification preferences saved")
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
@@ -3,35 +3,87 @@ package main
 import (
 	"blogalusta/internal/data"
 	"blogalusta/internal/forms"
+	"blogalusta/internal/markdown"
+	"bytes"
+	"fmt"
+	"github.com/alecthomas/chroma/styles"
 	"github.com/go-chi/chi/v5"
+	"image/jpeg"
 	"net/http"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func (app *application) handleShowPublicationPage(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
 	td := &templateData{}
-	var err error
 
-	td.Articles, err = app.models.Articles.GetArticlesOfPublication(app.publication(r))
+	if app.notModified(w, r, func() (*data.Freshness, error) {
+		return app.models.Publications.Freshness(r.Context(), publication)
+	}) {
+		return
+	}
+
+	var filters data.Filters
+	filters.PageSize = 10
+	filters.Sort = "-created_at"
+	filters.SortSafeList = []string{"-created_at"}
+
+	// archive pages list the articles of a year or a month
+	if yearStr := chi.URLParam(r, "year"); yearStr != "" {
+		year, err := strconv.Atoi(yearStr)
+		if err != nil || year < 1 || year > 9999 {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+
+		month := 0
+		if monthStr := chi.URLParam(r, "month"); monthStr != "" {
+			month, err = strconv.Atoi(monthStr)
+			if err != nil || month < 1 || month > 12 {
+				app.clientError(w, http.StatusNotFound)
+				return
+			}
+		}
+
+		if month == 0 {
+			filters.Since = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+			filters.Until = filters.Since.AddDate(1, 0, 0)
+		} else {
+			filters.Since = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, time.UTC)
+			filters.Until = filters.Since.AddDate(0, 1, 0)
+		}
+		td.ArchivePeriod = data.ArchiveMonth{Year: year, Month: month}
+	}
+
+	err := app.readPagination(r, &filters)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	td.Articles, td.Metadata, err = app.models.Articles.GetArticlesOfPublication(r.Context(), publication, filters)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	td.UserMap, err = app.models.Users.ArticleWriters(td.Articles)
+	td.Archive, err = app.models.Articles.Archive(r.Context(), publication)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	user := app.authenticatedUser(r)
-	td.LikeMap, err = app.models.Articles.LikesMany(td.Articles, user)
+	td.UserMap, err = app.loader(r).articleWriters(td.Articles)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	td.CommentCountMap, err = app.models.Comments.Counts(td.Articles)
+	user := app.authenticatedUser(r)
+	td.LikeMap, err = app.models.Articles.LikesMany(r.Context(), td.Articles, user)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -40,9 +92,14 @@ func (app *application) handleShowPublicationPage(w http.ResponseWriter, r *http
 	app.render(w, r, "publication.page.gohtml", td)
 }
 
+// coverURL matches the covers articles can have: images of the site, like
+// the ones of the media library, or served over https.
+var coverURL = regexp.MustCompile(`^(/[^/\s]|https://)\S*$`)
+
 func (app *application) handleShowCreateArticlePage(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, "new_article.page.gohtml", &templateData{
-		Form: forms.New(nil),
+		Form:         forms.New(nil),
+		ImageMaxSize: app.config.articleImage.maxSize,
 	})
 }
 
@@ -59,25 +116,126 @@ func (app *application) handleCreateArticle(w http.ResponseWriter, r *http.Reque
 	form := forms.New(r.PostForm)
 	form.Required("content", "title")
 	form.MaxLength("title", 255)
+	form.MaxLength("subtitle", 255)
+	form.MaxLength("excerpt", 300)
+	form.MaxLength("cover", 2048)
+	form.MatchesPattern("cover", coverURL)
 
 	if !form.Valid() {
 		app.render(w, r, "new_article.page.gohtml", &templateData{
-			Form: form,
+			Form:         form,
+			ImageMaxSize: app.config.articleImage.maxSize,
 		})
 		return
 	}
 
-	article, err := app.models.Articles.Publish(user, publication, form.Get("title"), form.Get("content"))
+	article := &data.Article{
+		Title:    form.Get("title"),
+		Subtitle: strings.TrimSpace(form.Get("subtitle")),
+		Content:  form.Get("content"),
+		Excerpt:  strings.Join(strings.Fields(form.Get("excerpt")), " "),
+		Cover:    strings.TrimSpace(form.Get("cover")),
+	}
+	err = app.models.Articles.Publish(r.Context(), user, publication, article)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	err = app.models.Notifications.ArticlePublished(r.Context(), article, user)
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
 	http.Redirect(w, r, publication.GetArticleURL(article), http.StatusSeeOther)
 }
 
+func (app *application) handleShowMediaLibraryPage(w http.ResponseWriter, r *http.Request) {
+	images, err := app.models.Images.ForPublication(r.Context(), app.publication(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "media.page.gohtml", &templateData{
+		Form:         forms.New(nil),
+		MediaImages:  images,
+		ImageMaxSize: app.config.articleImage.maxSize,
+	})
+}
+
+// handleUploadArticleImage adds an image to the media library of the
+// publication, scaled down to fit the article column. The editor uploads
+// images dragged or pasted into it and asks for JSON, the media library page
+// posts a regular form.
+func (app *application) handleUploadArticleImage(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	publication := app.publication(r)
+
+	img, err := app.readImage(w, r, app.config.articleImage.maxSize)
+	if err != nil {
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.MaxLength("alt", 255)
+	if !form.Valid() {
+		if app.wantsJSON(r) {
+			app.writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+				"error": form.Errors.Get("alt"),
+			})
+			return
+		}
+		app.session.Put(r, "flash_error", form.Errors.Get("alt"))
+		http.Redirect(w, r, publication.GetBaseURL()+"/media", http.StatusSeeOther)
+		return
+	}
+	alt := strings.TrimSpace(form.Get("alt"))
+
+	img = fitWidth(img, app.config.articleImage.maxWidth)
+
+	buffer := new(bytes.Buffer)
+	err = jpeg.Encode(buffer, img, nil)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	record, err := app.storeImage(r.Context(), buffer.Bytes(), "image/jpeg", img, user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	err = app.models.Images.AddToPublication(r.Context(), publication, record, user, alt)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if app.wantsJSON(r) {
+		app.writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"url":      originalImageURL(record.Hash),
+			"alt":      alt,
+			"width":    record.Width,
+			"height":   record.Height,
+			"markdown": imageMarkdown(alt, record.Hash),
+		})
+		return
+	}
+
+	app.session.Put(r, "flash", "Image uploaded")
+	http.Redirect(w, r, publication.GetBaseURL()+"/media", http.StatusSeeOther)
+}
+
 func (app *application) handleShowPublicationAboutPage(w http.ResponseWriter, r *http.Request) {
-	isWriter, err := app.models.Publications.UserIsWriter(app.publication(r), app.authenticatedUser(r))
+	if app.notModified(w, r, func() (*data.Freshness, error) {
+		return app.models.Publications.Freshness(r.Context(), app.publication(r))
+	}) {
+		return
+	}
+
+	isWriter, err := app.loader(r).isWriter(app.publication(r), app.authenticatedUser(r))
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -88,51 +246,162 @@ func (app *application) handleShowPublicationAboutPage(w http.ResponseWriter, r
 }
 
 func (app *application) handleShowPublicationSettingsPage(w http.ResponseWriter, r *http.Request) {
-	app.render(w, r, "publication_settings.page.gohtml", nil)
+	app.render(w, r, "publication_settings.page.gohtml", &templateData{
+		CodeStyles: styles.Names(),
+		Markdown:   markdownFeatureOptions(app.publication(r).MarkdownFeatures),
+	})
 }
 
-func (app *application) handleSubscribe(w http.ResponseWriter, r *http.Request) {
-	user := app.authenticatedUser(r)
+func (app *application) handleChangeCodeStyle(w http.ResponseWriter, r *http.Request) {
 	publication := app.publication(r)
 
-	isSubscribed, err := app.models.Publications.UserIsSubscribed(publication, user)
-	if isSubscribed || err != nil {
+	err := r.ParseForm()
+	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	// don't allow writers to subscribe
-	isWriter, err := app.models.Publications.UserIsWriter(publication, user)
-	if isWriter || err != nil {
+	style := r.PostForm.Get("style")
+	if !validCodeStyle(style) {
+		app.session.Put(r, "flash_error", "Unknown code style")
+		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+		return
+	}
+
+	err = app.models.Publications.ChangeCodeStyle(r.Context(), publication, style)
+	if err == data.ErrEditConflict {
+		app.invalidatePublication(r.Context(), publication.URL)
+		app.session.Put(r, "flash_error", "Edit conflict, please try again")
+		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.invalidatePublication(r.Context(), publication.URL)
+
+	app.session.Put(r, "flash", "Code style changed")
+	http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+}
+
+func (app *application) handleChangeMarkdownFeatures(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
+
+	err := r.ParseForm()
+	if err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	err = app.models.Users.SubscribeTo(user, publication)
+	features := []string{}
+	for _, name := range r.PostForm["feature"] {
+		if !markdown.ValidFeature(name) {
+			app.clientError(w, http.StatusBadRequest)
+			return
+		}
+		features = append(features, name)
+	}
+
+	err = app.models.Publications.ChangeMarkdownFeatures(r.Context(), publication, features)
+	if err == data.ErrEditConflict {
+		app.invalidatePublication(r.Context(), publication.URL)
+		app.session.Put(r, "flash_error", "Edit conflict, please try again")
+		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+	app.invalidatePublication(r.Context(), publication.URL)
+
+	app.session.Put(r, "flash", "Markdown extensions changed")
+	http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+}
+
+func (app *application) handleChangeHTMLPolicy(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
+
+	err := r.ParseForm()
 	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	hosts, invalid := parseFrameHosts(r.PostForm.Get("frame_hosts"))
+	if invalid != "" {
+		app.session.Put(r, "flash_error", fmt.Sprintf("%q is not a host name", invalid))
+		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+		return
+	}
+	if len(hosts) > maxFrameHosts {
+		app.session.Put(r, "flash_error", fmt.Sprintf("Frames can come from at most %d hosts", maxFrameHosts))
+		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+		return
+	}
+
+	tables := r.PostForm.Get("tables") == "on"
+
+	err = app.models.Publications.ChangeHTMLPolicy(r.Context(), publication, tables, hosts)
+	if err == data.ErrEditConflict {
+		app.invalidatePublication(r.Context(), publication.URL)
+		app.session.Put(r, "flash_error", "Edit conflict, please try again")
+		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
+		return
+	} else if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	app.invalidatePublication(r.Context(), publication.URL)
 
-	http.Redirect(w, r, publication.GetBaseURL(), http.StatusSeeOther)
+	app.session.Put(r, "flash", "HTML policy changed")
+	http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
 }
 
-func (app *application) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+func (app *application) handleSubscribe(w http.ResponseWriter, r *http.Request) {
 	user := app.authenticatedUser(r)
 	publication := app.publication(r)
 
-	isSubscribed, err := app.models.Publications.UserIsSubscribed(publication, user)
-	if !isSubscribed || err != nil {
+	// don't allow writers to subscribe
+	isWriter, err := app.loader(r).isWriter(publication, user)
+	if isWriter || err != nil {
 		app.clientError(w, http.StatusBadRequest)
 		return
 	}
 
-	err = app.models.Users.UnsubscribeFrom(user, publication)
+	subscribers, err := app.models.Users.SubscribeTo(r.Context(), user, publication)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.respondSubscription(w, r, publication, true, subscribers)
+}
+
+func (app *application) handleUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	publication := app.publication(r)
+
+	subscribers, err := app.models.Users.UnsubscribeFrom(r.Context(), user, publication)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
+	app.respondSubscription(w, r, publication, false, subscribers)
+}
+
+// respondSubscription answers a subscribe or unsubscribe request with the
+// state of the subscription, as JSON if the client asked for it and by
+// redirecting to the publication otherwise.
+func (app *application) respondSubscription(w http.ResponseWriter, r *http.Request, publication *data.Publication, subscribed bool, subscribers int) {
+	if app.wantsJSON(r) {
+		app.writeJSON(w, http.StatusOK, map[string]interface{}{
+			"subscribed":  subscribed,
+			"subscribers": subscribers,
+		})
+		return
+	}
+
 	http.Redirect(w, r, publication.GetBaseURL(), http.StatusSeeOther)
 }
 
@@ -155,14 +424,14 @@ func (app *application) handleInviteWriter(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	invited, err := app.models.Users.GetByEmail(form.Get("email"))
+	invited, err := app.models.Users.GetByEmail(r.Context(), form.Get("email"))
 	if err != nil {
 		app.session.Put(r, "flash_error", "User with this email not found")
 		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
 		return
 	}
 
-	isWriter, err := app.models.Publications.UserIsWriter(publication, invited)
+	isWriter, err := app.loader(r).isWriter(publication, invited)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -174,7 +443,7 @@ func (app *application) handleInviteWriter(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Publications.Invite(publication, invited)
+	err = app.models.Publications.Invite(r.Context(), publication, invited)
 	if err == data.ErrDuplicateRecord {
 		app.session.Put(r, "flash_error", "This user is already invited!")
 		http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
@@ -184,6 +453,11 @@ func (app *application) handleInviteWriter(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	err = app.models.Notifications.Invited(r.Context(), publication, invited, app.authenticatedUser(r))
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
 	http.Redirect(w, r, publication.GetSettingsURL(), http.StatusSeeOther)
 }
 
@@ -196,7 +470,7 @@ func (app *application) handleWithdrawInvitation(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = app.models.Publications.Withdraw(publication, id)
+	err = app.models.Publications.Withdraw(r.Context(), publication, id)
 	if err == data.ErrRecordNotFound {
 		app.clientError(w, http.StatusNotFound)
 		return
@@ -218,7 +492,7 @@ func (app *application) handleKickWriter(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	err = app.models.Publications.Kick(publication, id)
+	err = app.models.Publications.Kick(r.Context(), publication, id)
 	if err == data.ErrRecordNotFound {
 		app.clientError(w, http.StatusNotFound)
 		return
@@ -241,7 +515,7 @@ func (app *application) handleLikeArticlePublication(w http.ResponseWriter, r *h
 		return
 	}
 
-	article, err := app.models.Articles.Get(articleID)
+	article, err := app.models.Articles.Get(r.Context(), articleID)
 	if err == data.ErrRecordNotFound {
 		app.clientError(w, http.StatusNotFound)
 		return
@@ -250,12 +524,12 @@ func (app *application) handleLikeArticlePublication(w http.ResponseWriter, r *h
 		return
 	}
 
-	err = app.likeArticle(w, user, article)
+	like, err := app.likeArticle(w, r, user, article)
 	if err != nil {
 		return
 	}
 
-	http.Redirect(w, r, publication.GetBaseURL(), http.StatusSeeOther)
+	app.respondLike(w, r, like, publication.GetBaseURL())
 }
 
 func (app *application) handleUnlikeArticlePublication(w http.ResponseWriter, r *http.Request) {
@@ -268,7 +542,7 @@ func (app *application) handleUnlikeArticlePublication(w http.ResponseWriter, r
 		return
 	}
 
-	article, err := app.models.Articles.Get(articleID)
+	article, err := app.models.Articles.Get(r.Context(), articleID)
 	if err == data.ErrRecordNotFound {
 		app.clientError(w, http.StatusNotFound)
 		return
@@ -277,10 +551,10 @@ func (app *application) handleUnlikeArticlePublication(w http.ResponseWriter, r
 		return
 	}
 
-	err = app.unlikeArticle(w, user, article)
+	like, err := app.unlikeArticle(w, r, user, article)
 	if err != nil {
 		return
 	}
 
-	http.Redirect(w, r, publication.GetBaseURL(), http.StatusSeeOther)
+	app.respondLike(w, r, like, publication.GetBaseURL())
 }
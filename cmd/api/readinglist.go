@@ -0,0 +1,273 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"blogalusta/internal/forms"
+	"fmt"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"strconv"
+)
+
+func (app *application) handleBookmarkArticle(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
+	article := app.article(r)
+
+	err := app.models.Bookmarks.Add(r.Context(), app.authenticatedUser(r), article)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, publication.GetArticleURL(article), http.StatusSeeOther)
+}
+
+func (app *application) handleUnbookmarkArticle(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
+	article := app.article(r)
+
+	err := app.models.Bookmarks.Remove(r.Context(), app.authenticatedUser(r), article)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, publication.GetArticleURL(article), http.StatusSeeOther)
+}
+
+func (app *application) handleSaveArticleToList(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
+	article := app.article(r)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	listID, err := strconv.Atoi(r.PostForm.Get("list"))
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	list, err := app.models.ReadingLists.Get(r.Context(), listID)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	if list.UserID != app.authenticatedUser(r).ID {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.models.ReadingLists.AddArticle(r.Context(), list, article)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", fmt.Sprintf("Saved to %s", list.Name))
+	http.Redirect(w, r, publication.GetArticleURL(article), http.StatusSeeOther)
+}
+
+func (app *application) handleShowReadingListPage(w http.ResponseWriter, r *http.Request) {
+	page := 1
+	var err error
+	values := r.URL.Query()
+	if values.Has("p") {
+		page, err = strconv.Atoi(values.Get("p"))
+		if err != nil {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+		if page < 1 {
+			app.clientError(w, http.StatusNotFound)
+			return
+		}
+	}
+
+	var filters data.Filters
+	filters.Page = page
+	filters.PageSize = 10
+
+	user := app.authenticatedUser(r)
+	td := &templateData{Form: forms.New(nil)}
+
+	td.Articles, td.Metadata, err = app.models.Bookmarks.ForUser(r.Context(), user, filters)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	td.PubMap, err = app.loader(r).articlePublications(td.Articles)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	td.UserMap, err = app.loader(r).articleWriters(td.Articles)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	td.ReadingLists, err = app.models.ReadingLists.ForUser(r.Context(), user, true)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "reading_list.page.gohtml", td)
+}
+
+func (app *application) handleRemoveBookmark(w http.ResponseWriter, r *http.Request) {
+	articleID, err := strconv.Atoi(chi.URLParam(r, "articleID"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.models.Bookmarks.Remove(r.Context(), app.authenticatedUser(r), &data.Article{ID: articleID})
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/reading-list", http.StatusSeeOther)
+}
+
+func (app *application) handleCreateReadingList(w http.ResponseWriter, r *http.Request) {
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MaxLength("name", 64)
+
+	if !form.Valid() {
+		app.session.Put(r, "flash_error", form.Errors.Get("name"))
+		http.Redirect(w, r, "/user/reading-list", http.StatusSeeOther)
+		return
+	}
+
+	_, err = app.models.ReadingLists.Insert(r.Context(), app.authenticatedUser(r), form.Get("name"), form.Has("public"))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Created a new reading list")
+	http.Redirect(w, r, "/user/reading-list", http.StatusSeeOther)
+}
+
+func (app *application) handleUpdateReadingList(w http.ResponseWriter, r *http.Request) {
+	list := app.readingList(r)
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	form := forms.New(r.PostForm)
+	form.Required("name")
+	form.MaxLength("name", 64)
+
+	listURL := readingListURL(app.authenticatedUser(r), list)
+
+	if !form.Valid() {
+		app.session.Put(r, "flash_error", form.Errors.Get("name"))
+		http.Redirect(w, r, listURL, http.StatusSeeOther)
+		return
+	}
+
+	list.Name = form.Get("name")
+	list.Public = form.Has("public")
+
+	err = app.models.ReadingLists.Update(r.Context(), list)
+	if err == data.ErrEditConflict {
+		app.session.Put(r, "flash_error", "Edit conflict, please try again")
+		http.Redirect(w, r, listURL, http.StatusSeeOther)
+		return
+	} else if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", "Reading list updated")
+	http.Redirect(w, r, listURL, http.StatusSeeOther)
+}
+
+func (app *application) handleDeleteReadingList(w http.ResponseWriter, r *http.Request) {
+	list := app.readingList(r)
+
+	err := app.models.ReadingLists.Delete(r.Context(), list)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.session.Put(r, "flash", fmt.Sprintf("%s deleted!", list.Name))
+	http.Redirect(w, r, "/user/reading-list", http.StatusSeeOther)
+}
+
+func (app *application) handleRemoveFromReadingList(w http.ResponseWriter, r *http.Request) {
+	list := app.readingList(r)
+
+	articleID, err := strconv.Atoi(chi.URLParam(r, "articleID"))
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	err = app.models.ReadingLists.RemoveArticle(r.Context(), list, articleID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, readingListURL(app.authenticatedUser(r), list), http.StatusSeeOther)
+}
+
+func (app *application) handleShowReadingListArticlesPage(w http.ResponseWriter, r *http.Request) {
+	profile := app.profileUser(r)
+	list := app.readingList(r)
+	user := app.authenticatedUser(r)
+
+	isOwner := user != nil && user.ID == list.UserID
+	if list.UserID != profile.ID || (!list.Public && !isOwner) {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
+
+	td := &templateData{ReadingList: list}
+	var err error
+
+	td.Articles, err = app.models.ReadingLists.GetArticles(r.Context(), list)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	td.PubMap, err = app.loader(r).articlePublications(td.Articles)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	td.UserMap, err = app.loader(r).articleWriters(td.Articles)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "reading_list_articles.page.gohtml", td)
+}
@@ -9,17 +9,25 @@ import (
 func (app *application) routes() *chi.Mux {
 	r := chi.NewRouter()
 
-	r.Use(app.recoverPanic, app.logRequest, app.secureHeaders)
+	r.Use(app.recoverPanic, app.logRequest, app.countQueries, app.secureHeaders, app.loadRequest)
 
 	dynamic := []func(http.Handler) http.Handler{app.session.Enable, noSurf, app.authenticate}
 
-	r.With(dynamic...).Get("/", app.handleShowHomePage)
+	r.With(dynamic...).With(app.microCache).Get("/", app.handleShowHomePage)
 
 	r.With(dynamic...).With(app.requireAuthenticatedUser).Post("/{articleID:[0-9]+}/like", app.handleLikeArticleHome)
 	r.With(dynamic...).With(app.requireAuthenticatedUser).Post("/{articleID:[0-9]+}/unlike", app.handleUnlikeArticleHome)
 
-	r.Get("/img/{imageID:[0-9]+}.jpg", app.handleGetImage)
 	r.Get("/img/0.jpg", app.handleGetDefaultImage)
+	r.Get("/img/{imageID:[0-9]+}.jpg", app.handleRedirectImage)
+	r.Get("/img/{imageID:[0-9]+}/{size:[0-9]+}", app.handleRedirectImage)
+	r.Get("/img/{hash:[0-9a-f]{64}}-{size:[0-9]+}.jpg", app.handleGetImage)
+	r.Get("/img/{hash:[0-9a-f]{64}}.jpg", app.handleGetOriginalImage)
+	r.Get("/img/identicon/{seed:[0-9a-f]{16}}-{size:[0-9]+}.png", app.handleGetIdenticon)
+	r.Get("/css/code/{style:[a-z0-9_-]+}.css", app.handleGetCodeStyle)
+	r.Get("/robots.txt", app.handleGetRobots)
+	r.Get("/sitemap.xml", app.handleGetSitemapIndex)
+	r.With(app.addPublicationToContext).Get("/{publicationSlug:[a-z-]+}/sitemap.xml", app.handleGetPublicationSitemap)
 
 	r.Route("/user", func(r chi.Router) {
 		r.Use(dynamic...)
@@ -27,7 +35,12 @@ func (app *application) routes() *chi.Mux {
 		r.Post("/signup", app.handleSignup)
 		r.Get("/login", app.handleShowLoginPage)
 		r.Post("/login", app.handleLogin)
-		r.With(app.addProfileToContext).Get("/{profileSlug:[a-z0-9-]+-[0-9]+}", app.handleShowProfilePage)
+		r.With(app.addProfileToContext, app.microCache).Get("/{profileSlug:[a-z0-9-]+-[0-9]+}", app.handleShowProfilePage)
+		r.With(app.addProfileToContext).Get("/{profileSlug:[a-z0-9-]+-[0-9]+}/followers", app.handleShowFollowersPage)
+		r.With(app.addProfileToContext).Get("/{profileSlug:[a-z0-9-]+-[0-9]+}/following", app.handleShowFollowingPage)
+		r.With(app.addProfileToContext, app.requireAuthenticatedUser).Post("/{profileSlug:[a-z0-9-]+-[0-9]+}/follow", app.handleFollow)
+		r.With(app.addProfileToContext, app.requireAuthenticatedUser).Post("/{profileSlug:[a-z0-9-]+-[0-9]+}/unfollow", app.handleUnfollow)
+		r.With(app.addProfileToContext, app.addReadingListToContext).Get("/{profileSlug:[a-z0-9-]+-[0-9]+}/lists/{listID:[0-9]+}", app.handleShowReadingListArticlesPage)
 
 		r.Route("/", func(r chi.Router) {
 			r.Use(app.requireAuthenticatedUser)
@@ -40,12 +53,30 @@ func (app *application) routes() *chi.Mux {
 			r.Get("/invitations", app.handleShowUserInvitationsPage)
 			r.Post("/invitations/{id:[0-9]+}/accept", app.handleAcceptInvitation)
 			r.Post("/invitations/{id:[0-9]+}/decline", app.handleDeclineInvitation)
+			r.Get("/notifications", app.handleShowNotificationsPage)
+			r.Get("/notifications/events", app.handleNotificationEvents)
+			r.Post("/notifications/read", app.handleReadAllNotifications)
+			r.Post("/notifications/{id:[0-9]+}/read", app.handleReadNotification)
+
+			r.Route("/reading-list", func(r chi.Router) {
+				r.Get("/", app.handleShowReadingListPage)
+				r.Post("/", app.handleCreateReadingList)
+				r.Post("/bookmarks/{articleID:[0-9]+}/remove", app.handleRemoveBookmark)
+				r.Route("/{listID:[0-9]+}", func(r chi.Router) {
+					r.Use(app.addReadingListToContext, app.requireReadingListOwner)
+					r.Post("/edit", app.handleUpdateReadingList)
+					r.Post("/delete", app.handleDeleteReadingList)
+					r.Post("/{articleID:[0-9]+}/remove", app.handleRemoveFromReadingList)
+				})
+			})
 
 			r.Route("/settings", func(r chi.Router) {
 				r.Get("/", app.handleShowUserSettingsPage)
 				r.Post("/picture", app.handleChangeUserProfilePicture)
+				r.Post("/picture/{imageID:[0-9]+}/restore", app.handleRestoreUserProfilePicture)
 				r.Post("/name", app.handleChangeUserName)
 				r.Post("/password", app.handleChangeUserPassword)
+				r.Post("/notifications", app.handleChangeNotificationPreferences)
 			})
 		})
 	})
@@ -53,8 +84,10 @@ func (app *application) routes() *chi.Mux {
 	r.Route("/{publicationSlug:[a-z-]+}", func(r chi.Router) {
 		r.Use(app.addPublicationToContext)
 		r.Use(dynamic...)
-		r.Get("/", app.handleShowPublicationPage)
-		r.Get("/about", app.handleShowPublicationAboutPage)
+		r.With(app.microCache).Get("/", app.handleShowPublicationPage)
+		r.With(app.microCache).Get("/about", app.handleShowPublicationAboutPage)
+		r.With(app.microCache).Get("/archive/{year:[0-9]+}", app.handleShowPublicationPage)
+		r.With(app.microCache).Get("/archive/{year:[0-9]+}/{month:[0-9]+}", app.handleShowPublicationPage)
 
 		r.Route("/", func(r chi.Router) {
 			r.Use(app.requireAuthenticatedUser)
@@ -67,10 +100,15 @@ func (app *application) routes() *chi.Mux {
 				r.Use(app.requireUserIsWriter)
 				r.Get("/article", app.handleShowCreateArticlePage)
 				r.Post("/article", app.handleCreateArticle)
+				r.Get("/media", app.handleShowMediaLibraryPage)
+				r.Post("/media", app.handleUploadArticleImage)
 
 				r.Route("/", func(r chi.Router) {
 					r.Use(app.requireUserIsOwner)
 					r.Get("/settings", app.handleShowPublicationSettingsPage)
+					r.Post("/code-style", app.handleChangeCodeStyle)
+					r.Post("/markdown", app.handleChangeMarkdownFeatures)
+					r.Post("/policy", app.handleChangeHTMLPolicy)
 					r.Post("/invite", app.handleInviteWriter)
 					r.Post("/{userID:[0-9]+}/withdraw", app.handleWithdrawInvitation)
 					r.Post("/{userID:[0-9]+}/kick", app.handleKickWriter)
@@ -80,12 +118,16 @@ func (app *application) routes() *chi.Mux {
 		})
 		r.Route("/{articleSlug:[a-z0-9-]+-[0-9]+}", func(r chi.Router) {
 			r.Use(app.addArticleToContext)
-			r.Get("/", app.handleShowArticlePage)
+			r.With(app.microCache).Get("/", app.handleShowArticlePage)
+			r.Get("/events", app.handleArticleEvents)
 			r.Route("/", func(r chi.Router) {
 				r.Use(app.requireAuthenticatedUser)
 				r.Post("/like", app.handleLikeArticle)
 				r.Post("/unlike", app.handleUnlikeArticle)
 				r.Post("/comment", app.handleCreateComment)
+				r.Post("/bookmark", app.handleBookmarkArticle)
+				r.Post("/unbookmark", app.handleUnbookmarkArticle)
+				r.Post("/save", app.handleSaveArticleToList)
 				r.Route("/{commentID:[0-9]+}", func(r chi.Router) {
 					r.Use(app.addCommentToContext)
 					r.Post("/delete", app.handleDeleteComment)
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// siteName is the name of the site in link previews.
+const siteName = "Blogalusta"
+
+// pageMeta describes a page to search engines and link previews: its
+// canonical URL, the Open Graph properties of what it shows and the JSON-LD
+// of it. Only the canonical URL is set for pages that don't show an
+// article, a publication or a profile.
+type pageMeta struct {
+	Canonical   string
+	Type        string
+	Title       string
+	Description string
+	Image       string
+	Published   time.Time
+	// JSONLD is marshalled to JSON by the template
+	JSONLD map[string]any
+}
+
+// TwitterCard returns the kind of card the page is shared as.
+func (m *pageMeta) TwitterCard() string {
+	if m.Type == "article" && m.Image != "" {
+		return "summary_large_image"
+	}
+	return "summary"
+}
+
+// pageMeta returns the meta data of the page the template data is of.
+func (app *application) pageMeta(r *http.Request, td *templateData) *pageMeta {
+	path := r.URL.Path
+	if path != "/" {
+		path = strings.TrimSuffix(path, "/")
+	}
+	meta := &pageMeta{Canonical: absoluteURL(app.config.baseURL, path)}
+
+	switch {
+	case td.Article != nil && td.Publication != nil:
+		article, publication := td.Article, td.Publication
+		meta.Canonical = absoluteURL(app.config.baseURL, publication.GetArticleURL(article))
+		meta.Type = "article"
+		meta.Title = article.Title
+		meta.Description = article.Subtitle
+		if meta.Description == "" {
+			meta.Description = article.Excerpt
+		}
+		if article.Cover != "" {
+			meta.Image = absoluteURL(app.config.baseURL, article.Cover)
+		}
+		meta.Published = article.CreatedAt
+
+		ld := map[string]any{
+			"@context":         "https://schema.org",
+			"@type":            "Article",
+			"headline":         article.Title,
+			"description":      meta.Description,
+			"datePublished":    rfc3339(article.CreatedAt),
+			"wordCount":        article.WordCount,
+			"mainEntityOfPage": meta.Canonical,
+			"publisher":        app.organizationLD(publication),
+		}
+		if meta.Image != "" {
+			ld["image"] = []string{meta.Image}
+		}
+		if article.Writer != nil {
+			ld["author"] = app.personLD(article.Writer)
+		}
+		meta.JSONLD = ld
+	case td.Publication != nil:
+		publication := td.Publication
+		meta.Type = "website"
+		meta.Title = publication.Name
+		meta.Description = publication.Description
+		meta.JSONLD = app.organizationLD(publication)
+		meta.JSONLD["@context"] = "https://schema.org"
+	case td.ProfileUser != nil:
+		user := td.ProfileUser
+		meta.Type = "profile"
+		meta.Title = user.Name
+		meta.Description = fmt.Sprintf("Articles and publications of %s on %s.", user.Name, siteName)
+		meta.Image = absoluteURL(app.config.baseURL, userPic(user, 256))
+		meta.JSONLD = app.personLD(user)
+		meta.JSONLD["@context"] = "https://schema.org"
+	}
+
+	return meta
+}
+
+func (app *application) personLD(user *data.User) map[string]any {
+	return map[string]any{
+		"@type": "Person",
+		"name":  user.Name,
+		"url":   absoluteURL(app.config.baseURL, userURL(user)),
+		"image": absoluteURL(app.config.baseURL, userPic(user, 256)),
+	}
+}
+
+func (app *application) organizationLD(publication *data.Publication) map[string]any {
+	return map[string]any{
+		"@type":       "Organization",
+		"name":        publication.Name,
+		"url":         absoluteURL(app.config.baseURL, publication.GetBaseURL()),
+		"description": publication.Description,
+	}
+}
+
+// robots keeps crawlers off the pages that are private or only forms.
+const robots = `User-agent: *
+Disallow: /user/login
+Disallow: /user/signup
+Disallow: /user/settings
+Disallow: /user/notifications
+Disallow: /user/invitations
+Disallow: /user/reading-list
+Disallow: /user/publication/
+Disallow: /user/article
+Disallow: /*/settings
+Disallow: /*/media
+Disallow: /*/article$
+Disallow: /*/events$
+
+Sitemap: %s
+`
+
+func (app *application) handleGetRobots(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	fmt.Fprintf(w, robots, absoluteURL(app.config.baseURL, "/sitemap.xml"))
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func (app *application) sitemapURL(path string, lastMod time.Time) sitemapURL {
+	u := sitemapURL{Loc: absoluteURL(app.config.baseURL, path)}
+	if !lastMod.IsZero() {
+		u.LastMod = lastMod.UTC().Format(time.RFC3339)
+	}
+	return u
+}
+
+// handleGetSitemapIndex lists the sitemaps of the publications, one each,
+// so that no sitemap outgrows the limit of URLs.
+func (app *application) handleGetSitemapIndex(w http.ResponseWriter, r *http.Request) {
+	entries, err := app.models.Publications.Sitemap(r.Context())
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	index := sitemapIndex{}
+	for _, entry := range entries {
+		index.Sitemaps = append(index.Sitemaps, app.sitemapURL(entry.Path+"/sitemap.xml", entry.LastMod))
+	}
+	app.writeSitemap(w, index)
+}
+
+// handleGetPublicationSitemap lists the pages of the publication and its
+// articles.
+func (app *application) handleGetPublicationSitemap(w http.ResponseWriter, r *http.Request) {
+	publication := app.publication(r)
+
+	entries, err := app.models.Articles.Sitemap(r.Context(), publication)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	lastMod := publication.CreatedAt
+	if len(entries) > 0 && entries[0].LastMod.After(lastMod) {
+		lastMod = entries[0].LastMod
+	}
+
+	set := urlSet{URLs: []sitemapURL{
+		app.sitemapURL(publication.GetBaseURL(), lastMod),
+		app.sitemapURL(publication.GetAboutURL(), time.Time{}),
+	}}
+	for _, entry := range entries {
+		set.URLs = append(set.URLs, app.sitemapURL(entry.Path, entry.LastMod))
+	}
+	app.writeSitemap(w, set)
+}
+
+func (app *application) writeSitemap(w http.ResponseWriter, sitemap any) {
+	out, err := xml.MarshalIndent(sitemap, "", "  ")
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write([]byte(xml.Header))
+	w.Write(out)
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/gosimple/slug"
 	"html/template"
 	"io/fs"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"time"
@@ -14,34 +15,115 @@ import (
 
 type templateData struct {
 	CSRFToken   string
+	BaseURL     string
+	Meta        *pageMeta
 	Flash       string
 	FlashError  string
 	CurrentYear int
 	Form        *forms.Form
+	Query       url.Values
 
 	AuthenticatedUser   *data.User
-	HasPublications     bool
-	HasInvitations      bool
 	ProfileUser         *data.User
 	ProfilePublications *data.Profile
 	Publications        []*data.Publication
 
-	Publication    *data.Publication
-	Writers        []*data.User
-	InvitedWriters []*data.User
-	IsWriter       bool
-	IsSubscribed   bool
-	Article        *data.Article
-	Comments       []*data.Comment
-	Articles       []*data.Article
-	HTML           template.HTML
-	Like           *data.Like
+	Notifications           []*data.Notification
+	NotificationTypes       []string
+	NotificationPreferences map[string]bool
+
+	ReadingLists []*data.ReadingList
+	ReadingList  *data.ReadingList
+	Bookmarks    []*data.Article
+	IsBookmarked bool
+
+	Users       []*data.User
+	FollowList  string
+	IsFollowing bool
+	Followers   int
+	Following   int
+
+	Publication *data.Publication
+	IsWriter    bool
+	CodeStyles  []string
+	Markdown    []markdownFeature
+	Article     *data.Article
+	Comments    []*data.Comment
+	Articles    []*data.Article
+	HTML        template.HTML
+	Like        *data.Like
+
+	Sort   string
+	Period string
+
+	Archive       []*data.ArchiveMonth
+	ArchivePeriod data.ArchiveMonth
+
+	Avatars      []*data.Image
+	MediaImages  []*data.PublicationImage
+	ImageMaxSize int
+
+	Metadata   data.Metadata
+	NextCursor string
+	PrevCursor string
+	PubMap     map[int]*data.Publication
+	UserMap    map[int]*data.User
+	LikeMap    map[int]*data.Like
+
+	// loader looks up the data below only when a template asks for it
+	loader *loader
+}
+
+// Writers returns the writers of the publication.
+func (td *templateData) Writers() ([]*data.User, error) {
+	if td.loader == nil || td.Publication == nil {
+		return nil, nil
+	}
+	return td.loader.publicationWriters(td.Publication)
+}
 
-	Metadata        data.Metadata
-	PubMap          map[int]*data.Publication
-	UserMap         map[int]*data.User
-	LikeMap         map[int]*data.Like
-	CommentCountMap map[int]int
+// InvitedWriters returns the users invited to write on the publication.
+func (td *templateData) InvitedWriters() ([]*data.User, error) {
+	if td.loader == nil || td.Publication == nil {
+		return nil, nil
+	}
+	return td.loader.invitedWriters(td.Publication)
+}
+
+// IsSubscribed reports whether the authenticated user is subscribed to the
+// publication.
+func (td *templateData) IsSubscribed() (bool, error) {
+	if td.loader == nil {
+		return false, nil
+	}
+	return td.loader.isSubscribed(td.Publication, td.AuthenticatedUser)
+}
+
+// HasPublications reports whether the authenticated user writes on any
+// publication, for the navbar.
+func (td *templateData) HasPublications() (bool, error) {
+	if td.loader == nil || td.AuthenticatedUser == nil {
+		return false, nil
+	}
+	return td.loader.hasPublication(td.AuthenticatedUser)
+}
+
+// HasInvitations reports whether the authenticated user has pending
+// invitations, for the navbar.
+func (td *templateData) HasInvitations() (bool, error) {
+	if td.loader == nil || td.AuthenticatedUser == nil {
+		return false, nil
+	}
+	return td.loader.hasInvitation(td.AuthenticatedUser)
+}
+
+// UnreadNotifications returns the number of unread notifications of the
+// authenticated user, for the navbar.
+func (td *templateData) UnreadNotifications() (int, error) {
+	if td.loader == nil || td.AuthenticatedUser == nil {
+		return 0, nil
+	}
+	return td.loader.unreadNotifications(td.AuthenticatedUser)
 }
 
 func humanDate(t time.Time) string {
@@ -78,11 +160,24 @@ func userURL(user *data.User) string {
 	return fmt.Sprintf("/user/%s-%d", slug.Make(user.Name), user.ID)
 }
 
-func userPic(user *data.User) string {
+// userPic returns the URL of the picture of the user in the smallest size
+// that is still sharp when shown width pixels wide on high density screens.
+// Users without a picture get their identicon.
+func userPic(user *data.User, width int) string {
 	if !user.ImageID.Valid {
-		return fmt.Sprintf("/img/%d.jpg", 0)
+		return identiconURL(identiconSeed(user), sizeFor(width))
 	}
-	return fmt.Sprintf("/img/%d.jpg", user.ImageID.Int64)
+
+	return fmt.Sprintf("/img/%d/%d", user.ImageID.Int64, sizeFor(width))
+}
+
+// avatarPic returns the URL of a picture a user had, like userPic does.
+func avatarPic(image *data.Image, width int) string {
+	return imageURL(image.Hash, sizeFor(width))
+}
+
+func readingListURL(user *data.User, list *data.ReadingList) string {
+	return fmt.Sprintf("%s/lists/%d", userURL(user), list.ID)
 }
 
 func userIn(user *data.User, users []*data.User) bool {
@@ -95,6 +190,49 @@ func userIn(user *data.User, users []*data.User) bool {
 	return false
 }
 
+func notificationLabel(kind string) string {
+	switch kind {
+	case data.NotificationComment:
+		return "Comments on your articles"
+	case data.NotificationReply:
+		return "Comments on articles you have commented on"
+	case data.NotificationArticleLike:
+		return "Likes on your articles"
+	case data.NotificationCommentLike:
+		return "Likes on your comments"
+	case data.NotificationInvitation:
+		return "Invitations to write"
+	case data.NotificationInvitationAccepted:
+		return "Accepted invitations to your publications"
+	case data.NotificationNewArticle:
+		return "New articles in publications you subscribe to"
+	}
+	return kind
+}
+
+// pageQuery returns the query string of the given page, keeping the other
+// parameters of the current query.
+func pageQuery(query url.Values, page int) template.URL {
+	values := url.Values{}
+	for key, value := range query {
+		values[key] = value
+	}
+	values.Set("p", strconv.Itoa(page))
+	return template.URL("?" + values.Encode())
+}
+
+// cursorQuery returns the query string of the page at the cursor, keeping
+// the other parameters of the current query.
+func cursorQuery(query url.Values, cursor string) template.URL {
+	values := url.Values{}
+	for key, value := range query {
+		values[key] = value
+	}
+	values.Del("p")
+	values.Set("cursor", cursor)
+	return template.URL("?" + values.Encode())
+}
+
 func add(a, b int) int {
 	return a + b
 }
@@ -119,16 +257,45 @@ func join(a, b string) string {
 	return a + b
 }
 
+// absoluteURL resolves the URL against the URL of the site, for links shared
+// out of it.
+func absoluteURL(base, ref string) string {
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	u, err := b.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
 var functions = template.FuncMap{
 	"humanDate": humanDate,
 	"rfc3339":   rfc3339,
 	"userURL":   userURL,
 	"userPic":   userPic,
+	"avatarPic": avatarPic,
 	"userIn":    userIn,
 	"add":       add,
 	"seq":       seq,
 	"formatNum": formatNum,
 	"join":      join,
+	"pageQuery": pageQuery,
+
+	"absoluteURL": absoluteURL,
+
+	"cursorQuery": cursorQuery,
+
+	"notificationLabel": notificationLabel,
+	"readingListURL":    readingListURL,
+
+	"originalImageURL": originalImageURL,
+	"imageMarkdown":    imageMarkdown,
+
+	"codeStyle":    codeStyle,
+	"codeStyleURL": codeStyleURL,
 }
 
 func newTemplateCache(dir string) (map[string]*template.Template, error) {
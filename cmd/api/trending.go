@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// refreshTrending keeps recomputing the hot scores of the articles, which
+// decay with time even when nobody likes anything.
+func (app *application) refreshTrending(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		err := app.models.Articles.RefreshTrending(context.Background())
+		if err != nil {
+			app.errorLog.Print(err)
+		}
+	}
+}
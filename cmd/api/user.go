@@ -7,10 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
-	"image"
+	_ "golang.org/x/image/webp"
+	_ "image/gif"
 	"image/jpeg"
 	_ "image/png"
-	"io"
 	"net/http"
 	"net/mail"
 	"strconv"
@@ -48,7 +48,7 @@ func (app *application) handleSignup(w http.ResponseWriter, r *http.Request) {
 
 	email, _ := mail.ParseAddress(form.Get("email"))
 
-	id, err := app.models.Users.Insert(form.Get("name"), email.Address, form.Get("password"))
+	id, err := app.models.Users.Insert(r.Context(), form.Get("name"), email.Address, form.Get("password"))
 	if err == data.ErrDuplicateRecord {
 		app.session.Put(r, "flash_error", "Email address already in use")
 		app.render(w, r, "signup.page.gohtml", &templateData{Form: form})
@@ -78,7 +78,7 @@ func (app *application) handleLogin(w http.ResponseWriter, r *http.Request) {
 	}
 
 	form := forms.New(r.PostForm)
-	id, err := app.models.Users.Authenticate(form.Get("email"), form.Get("password"))
+	id, err := app.models.Users.Authenticate(r.Context(), form.Get("email"), form.Get("password"))
 	if err != nil {
 		app.errorLog.Print(err)
 	}
@@ -127,7 +127,7 @@ func (app *application) handleCreatePublication(w http.ResponseWriter, r *http.R
 	}
 
 	user := app.authenticatedUser(r)
-	url, err := app.models.Publications.Insert(user.ID, form.Get("name"), form.Get("description"))
+	url, err := app.models.Publications.Insert(r.Context(), user.ID, form.Get("name"), form.Get("description"))
 	if err == data.ErrDuplicateRecord {
 		app.session.Put(r, "flash_error", "Publication name already in use")
 		app.render(w, r, "create_publication.page.gohtml", &templateData{Form: form})
@@ -148,7 +148,31 @@ func (app *application) handleShowProfilePage(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	publications, err := app.models.Publications.GetUsersPublications(user.ID)
+	if app.notModified(w, r, func() (*data.Freshness, error) {
+		return app.models.Users.Freshness(r.Context(), user)
+	}) {
+		return
+	}
+
+	publications, err := app.models.Publications.GetUsersPublications(r.Context(), user.ID)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	lists, err := app.models.ReadingLists.ForUser(r.Context(), user, false)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	followers, following, err := app.models.Users.FollowCounts(r.Context(), user)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	isFollowing, err := app.models.Users.IsFollowing(r.Context(), app.authenticatedUser(r), user)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -156,16 +180,77 @@ func (app *application) handleShowProfilePage(w http.ResponseWriter, r *http.Req
 
 	app.render(w, r, "profile.page.gohtml", &templateData{
 		ProfilePublications: publications,
+		ReadingLists:        lists,
+		Followers:           followers,
+		Following:           following,
+		IsFollowing:         isFollowing,
+	})
+}
+
+func (app *application) handleFollow(w http.ResponseWriter, r *http.Request) {
+	user := app.authenticatedUser(r)
+	profile := app.profileUser(r)
+
+	if user.ID == profile.ID {
+		app.clientError(w, http.StatusBadRequest)
+		return
+	}
+
+	err := app.models.Users.Follow(r.Context(), user, profile)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, userURL(profile), http.StatusSeeOther)
+}
+
+func (app *application) handleUnfollow(w http.ResponseWriter, r *http.Request) {
+	profile := app.profileUser(r)
+
+	err := app.models.Users.Unfollow(r.Context(), app.authenticatedUser(r), profile)
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	http.Redirect(w, r, userURL(profile), http.StatusSeeOther)
+}
+
+func (app *application) handleShowFollowersPage(w http.ResponseWriter, r *http.Request) {
+	users, err := app.models.Users.Followers(r.Context(), app.profileUser(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "follows.page.gohtml", &templateData{
+		Users:      users,
+		FollowList: "Followers",
+	})
+}
+
+func (app *application) handleShowFollowingPage(w http.ResponseWriter, r *http.Request) {
+	users, err := app.models.Users.Following(r.Context(), app.profileUser(r))
+	if err != nil {
+		app.serverError(w, err)
+		return
+	}
+
+	app.render(w, r, "follows.page.gohtml", &templateData{
+		Users:      users,
+		FollowList: "Following",
 	})
 }
 
 func (app *application) handleDeletePublication(w http.ResponseWriter, r *http.Request) {
 	publication := app.publication(r)
-	err := app.models.Publications.Delete(publication)
+	err := app.models.Publications.Delete(r.Context(), publication)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	app.invalidatePublication(r.Context(), publication.URL)
 
 	app.session.Put(r, "flash", fmt.Sprintf("%s deleted!", publication.Name))
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -174,7 +259,7 @@ func (app *application) handleDeletePublication(w http.ResponseWriter, r *http.R
 func (app *application) handleShowChoosePublicationPage(w http.ResponseWriter, r *http.Request) {
 	user := app.authenticatedUser(r)
 
-	publications, err := app.models.Publications.GetUsersPublications(user.ID)
+	publications, err := app.models.Publications.GetUsersPublications(r.Context(), user.ID)
 	if err != nil {
 		app.serverError(w, err)
 		return
@@ -186,82 +271,99 @@ func (app *application) handleShowChoosePublicationPage(w http.ResponseWriter, r
 }
 
 func (app *application) handleShowUserSettingsPage(w http.ResponseWriter, r *http.Request) {
-	app.render(w, r, "user_settings.page.gohtml", nil)
-}
-
-func (app *application) handleChangeUserProfilePicture(w http.ResponseWriter, r *http.Request) {
-	err := r.ParseMultipartForm(int64(app.config.avatar.maxSize))
+	prefs, err := app.models.Notifications.Preferences(r.Context(), app.authenticatedUser(r))
 	if err != nil {
-		app.clientError(w, http.StatusRequestEntityTooLarge)
-		app.errorLog.Print(err)
+		app.serverError(w, err)
 		return
 	}
 
-	file, _, err := r.FormFile("image")
+	avatars, err := app.models.Users.Avatars(r.Context(), app.authenticatedUser(r))
 	if err != nil {
-		app.clientError(w, http.StatusBadRequest)
-		app.errorLog.Print(err)
+		app.serverError(w, err)
 		return
 	}
-	defer file.Close()
 
-	buf := make([]byte, 512)
-	_, err = file.Read(buf)
-	if err != nil {
-		app.serverError(w, err)
-		return
+	// the current picture is shown above the pictures to go back to
+	previous := avatars[:0]
+	for _, avatar := range avatars {
+		if int64(avatar.ID) != app.authenticatedUser(r).ImageID.Int64 {
+			previous = append(previous, avatar)
+		}
 	}
 
-	filetype := http.DetectContentType(buf)
-	if filetype != "image/jpeg" && filetype != "image/png" {
-		app.clientError(w, http.StatusUnsupportedMediaType)
-		app.errorLog.Print(filetype)
+	app.render(w, r, "user_settings.page.gohtml", &templateData{
+		NotificationTypes:       data.NotificationTypes,
+		NotificationPreferences: prefs,
+		Avatars:                 previous,
+	})
+}
+
+func (app *application) handleChangeUserProfilePicture(w http.ResponseWriter, r *http.Request) {
+	img, err := app.readImage(w, r, app.config.avatar.maxSize)
+	if err != nil {
 		return
 	}
 
-	_, err = file.Seek(0, io.SeekStart)
+	crop, err := readCrop(r.PostForm, img.Bounds())
 	if err != nil {
-		app.serverError(w, err)
+		app.session.Put(r, "flash_error", "Invalid crop of the picture")
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
 		return
 	}
+	img = cropResize(img, crop, app.config.avatar.sideLength)
 
-	img, _, err := image.Decode(file)
+	buffer := new(bytes.Buffer)
+	err = jpeg.Encode(buffer, img, nil)
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	img, err = cropCenterResize(img, app.config.avatar.sideLength)
+	record, err := app.storeImage(r.Context(), buffer.Bytes(), "image/jpeg", img, app.authenticatedUser(r))
 	if err != nil {
 		app.serverError(w, err)
 		return
 	}
 
-	buffer := new(bytes.Buffer)
-	err = jpeg.Encode(buffer, img, nil)
-	if err != nil {
+	err = app.models.Users.ChangeProfilePicture(r.Context(), app.authenticatedUser(r), record.ID)
+	if err == data.ErrEditConflict {
+		app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
+		app.session.Put(r, "flash_error", "Edit conflict, please try again")
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	} else if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
 
-	id, err := app.models.Images.Insert(buffer.Bytes())
+	w.WriteHeader(http.StatusCreated)
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+func (app *application) handleRestoreUserProfilePicture(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "imageID"))
 	if err != nil {
-		app.serverError(w, err)
+		app.clientError(w, http.StatusNotFound)
 		return
 	}
 
-	err = app.models.Users.ChangeProfilePicture(app.authenticatedUser(r), id)
-	if err != nil {
+	err = app.models.Users.RestoreProfilePicture(r.Context(), app.authenticatedUser(r), id)
+	if err == data.ErrRecordNotFound {
+		app.clientError(w, http.StatusNotFound)
+		return
+	} else if err != nil {
 		app.serverError(w, err)
 		return
 	}
+	app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
 
-	w.WriteHeader(http.StatusCreated)
+	app.session.Put(r, "flash", "Profile picture restored")
 	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
 }
 
 func (app *application) handleShowUserInvitationsPage(w http.ResponseWriter, r *http.Request) {
-	invitations, err := app.models.Users.Invitations(app.authenticatedUser(r))
+	invitations, err := app.models.Users.Invitations(r.Context(), app.authenticatedUser(r))
 	if err == data.ErrRecordNotFound {
 		// do nothing
 	} else if err != nil {
@@ -281,7 +383,7 @@ func (app *application) handleAcceptInvitation(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = app.models.Users.AcceptInvitation(app.authenticatedUser(r), id)
+	err = app.models.Users.AcceptInvitation(r.Context(), app.authenticatedUser(r), id)
 	if err != nil {
 		switch err {
 		case data.ErrRecordNotFound:
@@ -298,6 +400,11 @@ func (app *application) handleAcceptInvitation(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	err = app.models.Notifications.InvitationAccepted(r.Context(), id, app.authenticatedUser(r))
+	if err != nil {
+		app.errorLog.Print(err)
+	}
+
 	app.session.Put(r, "flash", "Accepted invite")
 	http.Redirect(w, r, "/user/invitations", http.StatusSeeOther)
 }
@@ -309,7 +416,7 @@ func (app *application) handleDeclineInvitation(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	err = app.models.Users.DeclineInvitation(app.authenticatedUser(r), id)
+	err = app.models.Users.DeclineInvitation(r.Context(), app.authenticatedUser(r), id)
 	if err != nil {
 		switch err {
 		case data.ErrRecordNotFound:
@@ -333,7 +440,7 @@ func (app *application) handleLeavePublication(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = app.models.Users.Leave(app.authenticatedUser(r), publicationID)
+	err = app.models.Users.Leave(r.Context(), app.authenticatedUser(r), publicationID)
 	if err != nil {
 		switch err {
 		case data.ErrRecordNotFound:
@@ -366,8 +473,9 @@ func (app *application) handleChangeUserName(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	err = app.models.Users.ChangeName(app.authenticatedUser(r), form.Get("name"))
+	err = app.models.Users.ChangeName(r.Context(), app.authenticatedUser(r), form.Get("name"))
 	if err == data.ErrEditConflict {
+		app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
 		app.session.Put(r, "flash_error", "Edit conflict, please try again")
 		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
 		return
@@ -375,6 +483,7 @@ func (app *application) handleChangeUserName(w http.ResponseWriter, r *http.Requ
 		app.serverError(w, err)
 		return
 	}
+	app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
 
 	app.session.Put(r, "flash", fmt.Sprintf("Changed name to %s", form.Get("name")))
 	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
@@ -408,8 +517,9 @@ func (app *application) handleChangeUserPassword(w http.ResponseWriter, r *http.
 		return
 	}
 
-	err = app.models.Users.ChangePassword(app.authenticatedUser(r), form.Get("old-password"), form.Get("new-password-0"))
+	err = app.models.Users.ChangePassword(r.Context(), app.authenticatedUser(r), form.Get("old-password"), form.Get("new-password-0"))
 	if err == data.ErrEditConflict {
+		app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
 		app.session.Put(r, "flash_error", "Edit conflict, please try again")
 		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
 		return
@@ -421,6 +531,7 @@ func (app *application) handleChangeUserPassword(w http.ResponseWriter, r *http.
 		app.serverError(w, err)
 		return
 	}
+	app.invalidateUser(r.Context(), app.authenticatedUser(r).ID)
 
 	app.session.Put(r, "flash", "Changed password, please log back in.")
 	app.session.Pop(r, "userID")
@@ -428,26 +539,18 @@ func (app *application) handleChangeUserPassword(w http.ResponseWriter, r *http.
 }
 
 func (app *application) handleShowPublicationListPage(w http.ResponseWriter, r *http.Request) {
-	page := 1
-	var err error
-	values := r.URL.Query()
-	if values.Has("p") {
-		page, err = strconv.Atoi(values.Get("p"))
-		if err != nil {
-			app.clientError(w, http.StatusNotFound)
-			return
-		}
-		if page < 1 {
-			app.clientError(w, http.StatusNotFound)
-			return
-		}
-	}
-
 	var filters data.Filters
-	filters.Page = page
 	filters.PageSize = 10
+	filters.Sort = "-subscribers"
+	filters.SortSafeList = []string{"-subscribers"}
+
+	err := app.readPagination(r, &filters)
+	if err != nil {
+		app.clientError(w, http.StatusNotFound)
+		return
+	}
 
-	publications, metaData, err := app.models.Publications.Publications(filters)
+	publications, metaData, err := app.models.Publications.Publications(r.Context(), filters)
 	if err == data.ErrRecordNotFound {
 
 	} else if err != nil {
@@ -455,7 +558,7 @@ func (app *application) handleShowPublicationListPage(w http.ResponseWriter, r *
 		return
 	}
 
-	userMap, err := app.models.Users.PublicationOwners(publications)
+	userMap, err := app.loader(r).publicationOwners(publications)
 	if err == data.ErrRecordNotFound {
 
 	} else if err != nil {
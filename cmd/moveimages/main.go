@@ -0,0 +1,127 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"blogalusta/internal/storage"
+	"bytes"
+	"context"
+	"database/sql"
+	"flag"
+	_ "github.com/lib/pq"
+	_ "golang.org/x/image/webp"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"log"
+	"os"
+	"time"
+)
+
+// moveimages moves the images and image variants still stored in the
+// database to the configured blob storage, a batch at a time. Each row is
+// cleared only once its blob is stored, so the command can be stopped and
+// run again.
+func main() {
+	var cfg storage.Config
+
+	dsn := flag.String("db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
+	batch := flag.Int("batch", 100, "Rows moved per query")
+	flag.StringVar(&cfg.Backend, "storage", envOr("STORAGE", "fs"), "Image storage backend (fs|s3)")
+	flag.StringVar(&cfg.Dir, "storage-dir", envOr("STORAGE_DIR", "./blobs"), "Image storage directory of the fs backend")
+	flag.StringVar(&cfg.S3.Endpoint, "s3-endpoint", os.Getenv("S3_ENDPOINT"), "S3 compatible service URL")
+	flag.StringVar(&cfg.S3.Region, "s3-region", envOr("S3_REGION", "us-east-1"), "S3 region")
+	flag.StringVar(&cfg.S3.Bucket, "s3-bucket", os.Getenv("S3_BUCKET"), "S3 bucket")
+	flag.StringVar(&cfg.S3.AccessKey, "s3-access-key", os.Getenv("S3_ACCESS_KEY"), "S3 access key")
+	flag.StringVar(&cfg.S3.SecretKey, "s3-secret-key", os.Getenv("S3_SECRET_KEY"), "S3 secret key")
+	flag.Parse()
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	store, err := storage.Open(cfg)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	models := data.NewModels(&data.DB{DB: db})
+	ctx = context.Background()
+
+	moved := 0
+	for {
+		images, err := models.Images.Unmoved(ctx, *batch)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if len(images) == 0 {
+			break
+		}
+
+		for _, img := range images {
+			err = store.Put(ctx, data.ImageKey(img.Hash), img.Data, img.ContentType)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+
+			img.Size = len(img.Data)
+			config, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+			if err != nil {
+				errorLog.Printf("image %d: %v", img.ID, err)
+			} else {
+				img.Width, img.Height = config.Width, config.Height
+			}
+
+			err = models.Images.Moved(ctx, img)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+			moved++
+		}
+	}
+	infoLog.Printf("moved %d images\n", moved)
+
+	moved = 0
+	for {
+		variants, err := models.Images.UnmovedVariants(ctx, *batch)
+		if err != nil {
+			errorLog.Fatal(err)
+		}
+		if len(variants) == 0 {
+			break
+		}
+
+		for _, v := range variants {
+			err = store.Put(ctx, data.VariantKey(v.Hash, v.Size, v.ContentType), v.Data, v.ContentType)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+
+			err = models.Images.VariantMoved(ctx, v)
+			if err != nil {
+				errorLog.Fatal(err)
+			}
+			moved++
+		}
+	}
+	infoLog.Printf("moved %d image variants\n", moved)
+}
+
+func envOr(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"blogalusta/internal/data"
+	"context"
+	"database/sql"
+	"flag"
+	_ "github.com/lib/pq"
+	"log"
+	"os"
+	"time"
+)
+
+// reconcile repairs the like, comment and subscriber counters that the
+// database triggers maintain, should they ever drift from the actual rows, and
+// refreshes the trending scores computed from them.
+func main() {
+	dsn := flag.String("db-dsn", os.Getenv("DATABASE_URL"), "PostgreSQL DSN")
+	slowQuery := flag.Duration("db-slow-query", 0, "Log PostgreSQL queries slower than this, 0 to disable")
+	flag.Parse()
+
+	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
+	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
+
+	db, err := sql.Open("postgres", *dsn)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	err = db.PingContext(ctx)
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+
+	models := data.NewModels(&data.DB{DB: db, SlowQuery: *slowQuery, Logger: infoLog})
+
+	repaired, err := models.Articles.ReconcileCounters(context.Background())
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	infoLog.Printf("repaired %d counters\n", repaired)
+
+	err = models.Articles.RefreshTrending(context.Background())
+	if err != nil {
+		errorLog.Fatal(err)
+	}
+	infoLog.Println("refreshed trending scores")
+}
@@ -4,6 +4,8 @@ module blogalusta
 go 1.18
 
 require (
+	github.com/a-h/hsts v0.0.0-20170713145656-509101faf0de
+	github.com/alecthomas/chroma v0.10.0
 	github.com/go-chi/chi/v5 v5.0.7
 	github.com/golang-migrate/migrate/v4 v4.15.1
 	github.com/golangcollege/sessions v1.2.0
@@ -14,16 +16,16 @@ require (
 	github.com/microcosm-cc/bluemonday v1.0.18
 	golang.org/x/crypto v0.0.0-20220411220226-7b82a4e95df4
 	golang.org/x/image v0.0.0-20220413100746-70e8d0d3baa9
+	golang.org/x/net v0.0.0-20220412020605-290c469a71a5
 )
 
 require (
-	github.com/a-h/hsts v0.0.0-20170713145656-509101faf0de // indirect
 	github.com/aymerick/douceur v0.2.0 // indirect
+	github.com/dlclark/regexp2 v1.4.0 // indirect
 	github.com/gorilla/css v1.0.0 // indirect
 	github.com/gosimple/unidecode v1.0.1 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
 	go.uber.org/atomic v1.9.0 // indirect
-	golang.org/x/net v0.0.0-20220412020605-290c469a71a5 // indirect
 	golang.org/x/sys v0.0.0-20220412071739-889880a91fd5 // indirect
 )
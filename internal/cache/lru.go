@@ -0,0 +1,134 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// LRU is a cache holding entries up to a fixed total weight, evicting the
+// least recently used ones to make room for new ones. Entries weigh one
+// unless the cache weighs them otherwise, so the size is usually a number of
+// entries. Entries also expire after a time to live. It is safe for
+// concurrent use.
+type LRU[K comparable, V any] struct {
+	mu      sync.Mutex
+	size    int
+	used    int
+	ttl     time.Duration
+	weigh   func(V) int
+	order   *list.List
+	entries map[K]*list.Element
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	weight  int
+	expires time.Time
+}
+
+// New returns a cache holding up to size entries for ttl each.
+func New[K comparable, V any](size int, ttl time.Duration) *LRU[K, V] {
+	return NewWeighted[K, V](size, ttl, func(V) int { return 1 })
+}
+
+// NewWeighted returns a cache holding entries for ttl each up to a total
+// weight of size, as weighed by weigh. Values weighing more than size
+// aren't stored.
+func NewWeighted[K comparable, V any](size int, ttl time.Duration, weigh func(V) int) *LRU[K, V] {
+	return &LRU[K, V]{
+		size:    size,
+		ttl:     ttl,
+		weigh:   weigh,
+		order:   list.New(),
+		entries: make(map[K]*list.Element),
+	}
+}
+
+// Get returns the value stored under the key, if it is there and hasn't
+// expired.
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var zero V
+
+	el, ok := c.entries[key]
+	if !ok {
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Set stores the value under the key, evicting the least recently used
+// entries if the cache is full.
+func (c *LRU[K, V]) Set(key K, value V) {
+	if c.size <= 0 {
+		return
+	}
+
+	weight := c.weigh(value)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+	if weight > c.size {
+		return
+	}
+
+	e := &entry[K, V]{key: key, value: value, weight: weight, expires: time.Now().Add(c.ttl)}
+	c.entries[key] = c.order.PushFront(e)
+	c.used += weight
+
+	for c.used > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Delete removes the key from the cache.
+func (c *LRU[K, V]) Delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Clear removes every entry from the cache.
+func (c *LRU[K, V]) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[K]*list.Element)
+	c.used = 0
+}
+
+// Len returns the number of entries in the cache, including expired ones
+// that haven't been evicted yet.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) remove(el *list.Element) {
+	e := el.Value.(*entry[K, V])
+	c.order.Remove(el)
+	delete(c.entries, e.key)
+	c.used -= e.weight
+}
@@ -0,0 +1,35 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWeightedEviction(t *testing.T) {
+	c := NewWeighted[string, []byte](10, time.Minute, func(b []byte) int { return len(b) })
+
+	c.Set("a", make([]byte, 4))
+	c.Set("b", make([]byte, 4))
+	c.Get("a")
+	c.Set("c", make([]byte, 4))
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("the least recently used entry wasn't evicted")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("a recently used entry was evicted")
+	}
+
+	c.Set("a", make([]byte, 6))
+	if _, ok := c.Get("c"); !ok {
+		t.Error("replacing an entry didn't release its old weight")
+	}
+
+	c.Set("big", make([]byte, 11))
+	if _, ok := c.Get("big"); ok {
+		t.Error("an entry heavier than the cache was stored")
+	}
+	if c.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", c.Len())
+	}
+}
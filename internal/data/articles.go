@@ -5,18 +5,34 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/gosimple/slug"
+	"github.com/lib/pq"
+	"strings"
 	"time"
 )
 
 type Article struct {
 	ID            int
 	Title         string
+	Subtitle      string
 	Content       string
 	PublicationID int
 	WriterID      int
 	CreatedAt     time.Time
 	Version       int
 
+	Likes    int
+	Comments int
+
+	// computed from the content when it is saved, see setMetadata, and set
+	// instead of it for the summaries in listings
+	Excerpt     string
+	Cover       string
+	WordCount   int
+	ReadingTime int
+	// noExcerpt is set on summaries whose Excerpt holds the start of the
+	// content to make one from
+	noExcerpt bool
+
 	URL string
 
 	// relations
@@ -36,98 +52,220 @@ func (a *Article) Matches(url string) bool {
 	return url == slug.Make(a.Title)
 }
 
+// HeaderCover returns the cover to show above the content of the article,
+// none if the cover is an image the content shows already.
+func (a *Article) HeaderCover() string {
+	if a.Cover == "" || strings.Contains(a.Content, "("+a.Cover) {
+		return ""
+	}
+	return a.Cover
+}
+
+// summaryColumns selects an article summary from the article table with the
+// given alias: the article, its metadata and its counters without the
+// content. Articles saved before excerpts were stored have the start of
+// their content selected to make one from.
+func summaryColumns(article string) string {
+	return fmt.Sprintf(`%[1]s.id, %[1]s.title, %[1]s.subtitle,
+		CASE WHEN %[1]s.excerpt = '' THEN left(%[1]s.content, 1000) ELSE %[1]s.excerpt END, %[1]s.excerpt = '',
+		%[1]s.cover, %[1]s.word_count, %[1]s.reading_time,
+		%[1]s.publication_id, %[1]s.writer_id, %[1]s.created_at, %[1]s.version, %[1]s.likes, %[1]s.comments`, article)
+}
+
+// summaryFields returns the scan destinations of the columns selected by
+// summaryColumns. setSummary has to be called once the row is scanned.
+func (a *Article) summaryFields() []any {
+	return []any{&a.ID, &a.Title, &a.Subtitle, &a.Excerpt, &a.noExcerpt, &a.Cover, &a.WordCount, &a.ReadingTime,
+		&a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version, &a.Likes, &a.Comments}
+}
+
+func (a *Article) setSummary() {
+	if a.noExcerpt {
+		a.Excerpt = excerpt(a.Excerpt)
+	}
+	a.SetURL()
+}
+
+// ArchiveMonth is a month in which articles were published in a publication.
+type ArchiveMonth struct {
+	Year     int
+	Month    int
+	Articles int
+}
+
+func (m ArchiveMonth) MonthName() string {
+	return time.Month(m.Month).String()
+}
+
 type ArticleModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (m *ArticleModel) Publish(writer *User, publication *Publication, title, content string) (*Article, error) {
+// Publish saves the article, its Title, Subtitle, Content and optionally
+// Excerpt and Cover set, as written by the writer in the publication. The
+// rest of its metadata is computed from the content.
+func (m *ArticleModel) Publish(ctx context.Context, writer *User, publication *Publication, a *Article) error {
 	query := `
-		INSERT INTO article (title, content, publication_id, writer_id)
-		VALUES ($1, $2, $3, $4)
-		RETURNING id, title, content, publication_id, writer_id, created_at, version`
+		INSERT INTO article (title, subtitle, content, excerpt, cover, word_count, reading_time, publication_id,
+		                     writer_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, publication_id, writer_id, created_at, version`
 
-	a := &Article{}
+	a.setMetadata()
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	row := m.DB.QueryRowContext(ctx, query, title, content, publication.ID, writer.ID)
-	err := row.Scan(&a.ID, &a.Title, &a.Content, &a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version)
+	row := m.DB.QueryRowContext(ctx, query, a.Title, a.Subtitle, a.Content, a.Excerpt, a.Cover, a.WordCount,
+		a.ReadingTime, publication.ID, writer.ID)
+	err := row.Scan(&a.ID, &a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	a.SetURL()
 
-	return a, nil
+	return nil
 }
 
-func (m *ArticleModel) Get(articleID int) (*Article, error) {
+func (m *ArticleModel) Get(ctx context.Context, articleID int) (*Article, error) {
 	query := `
-		SELECT a.id, a.title, a.content, a.publication_id, a.writer_id, a.created_at, a.version
+		SELECT a.id, a.title, a.subtitle, a.content, a.excerpt, a.cover, a.word_count, a.reading_time,
+			a.publication_id, a.writer_id, a.created_at, a.version
 		FROM article a
 		WHERE a.id = $1`
 
 	a := &Article{}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, articleID)
-	err := row.Scan(&a.ID, &a.Title, &a.Content, &a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version)
+	err := row.Scan(&a.ID, &a.Title, &a.Subtitle, &a.Content, &a.Excerpt, &a.Cover, &a.WordCount, &a.ReadingTime,
+		&a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version)
 	if err == sql.ErrNoRows {
 		return nil, ErrRecordNotFound
 	} else if err != nil {
 		return nil, err
 	}
+	if a.Excerpt == "" {
+		a.Excerpt = excerpt(a.Content)
+	}
 	a.SetURL()
 
 	return a, nil
 }
 
-func (m *ArticleModel) GetArticlesOfPublication(publication *Publication) ([]*Article, error) {
+// GetArticlesOfPublication returns the summaries of the articles published
+// in the publication within the Since and Until of the filters. They are only
+// sorted by date, so the hot score is left out as zero.
+func (m *ArticleModel) GetArticlesOfPublication(ctx context.Context, publication *Publication, filters Filters) ([]*Article, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, %s, 0
+		FROM article a
+		WHERE a.publication_id = $1
+		  AND ($2::timestamptz IS NULL OR a.created_at >= $2)
+		  AND ($3::timestamptz IS NULL OR a.created_at < $3)
+		  AND %s
+		ORDER BY %s
+		LIMIT $4 OFFSET $5`, filters.totalRecords(), summaryColumns("a"), filters.keyset("a", 6), filters.orderBy("a"))
+
+	args := append([]any{publication.ID, filters.since(), filters.until(), filters.limit(), filters.offset()}, filters.keysetArgs()...)
+
+	return m.feed(ctx, query, filters, args...)
+}
+
+// Archive returns the months in which articles were published in the
+// publication, latest first.
+func (m *ArticleModel) Archive(ctx context.Context, publication *Publication) ([]*ArchiveMonth, error) {
 	query := `
-		SELECT id, title, content, publication_id, writer_id, created_at, version
+		SELECT extract(year FROM created_at AT TIME ZONE 'UTC')::int,
+		       extract(month FROM created_at AT TIME ZONE 'UTC')::int,
+		       count(*)
 		FROM article
 		WHERE publication_id = $1
-		ORDER BY created_at DESC`
+		GROUP BY 1, 2
+		ORDER BY 1 DESC, 2 DESC`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	var articles []*Article
-
 	rows, err := m.DB.QueryContext(ctx, query, publication.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []*ArchiveMonth
 	for rows.Next() {
-		a := &Article{}
-		err = rows.Scan(&a.ID, &a.Title, &a.Content, &a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version)
+		month := &ArchiveMonth{}
+		err = rows.Scan(&month.Year, &month.Month, &month.Articles)
 		if err != nil {
 			return nil, err
 		}
-		a.SetURL()
-		articles = append(articles, a)
+		months = append(months, month)
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, err
 	}
 
-	return articles, nil
+	return months, nil
 }
 
-func (m *ArticleModel) Articles(filters Filters) ([]*Article, Metadata, error) {
-	query := `
-		SELECT count(*) OVER(), id, title, content, publication_id, writer_id, created_at, version, count(al.article_id) as likes
-		FROM article
-		LEFT JOIN article_like al on article.id = al.article_id
-		WHERE created_at > now() - INTERVAL '1 week'
-		GROUP BY id
-		ORDER BY likes DESC, id DESC
-		LIMIT $1 OFFSET $2`
+func (m *ArticleModel) Articles(ctx context.Context, filters Filters) ([]*Article, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, %s, a.hot
+		FROM (
+			SELECT a.*, coalesce(t.score, 0) as hot
+			FROM article a
+			LEFT JOIN article_trending t on a.id = t.article_id
+			WHERE ($1::timestamptz IS NULL OR a.created_at >= $1)
+		) a
+		WHERE %s
+		ORDER BY %s
+		LIMIT $2 OFFSET $3`, filters.totalRecords(), summaryColumns("a"), filters.keyset("a", 4), filters.orderBy("a"))
+
+	args := append([]any{filters.since(), filters.limit(), filters.offset()}, filters.keysetArgs()...)
+
+	return m.feed(ctx, query, filters, args...)
+}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// SubscribedArticles returns the articles of the publications the user
+// subscribes to and of the writers the user follows, blended with the given
+// number of articles trending over the past week.
+func (m *ArticleModel) SubscribedArticles(ctx context.Context, filters Filters, user *User, trending int) ([]*Article, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, %s, a.hot
+		FROM (
+			SELECT a.*, coalesce(t.score, 0) as hot
+			FROM article a
+			LEFT JOIN article_trending t on a.id = t.article_id
+			WHERE (a.publication_id IN (SELECT publication_id FROM subscribes_to WHERE user_id = $1)
+			   OR a.writer_id IN (SELECT followee_id FROM follows WHERE follower_id = $1)
+			   OR a.id IN (
+			       SELECT article_id
+			       FROM article_trending
+			       WHERE created_at > now() - INTERVAL '1 week'
+			       ORDER BY score DESC, article_id DESC
+			       LIMIT $2))
+			  AND ($3::timestamptz IS NULL OR a.created_at >= $3)
+		) a
+		WHERE %s
+		ORDER BY %s
+		LIMIT $4 OFFSET $5`, filters.totalRecords(), summaryColumns("a"), filters.keyset("a", 6), filters.orderBy("a"))
+
+	args := append([]any{user.ID, trending, filters.since(), filters.limit(), filters.offset()}, filters.keysetArgs()...)
+
+	return m.feed(ctx, query, filters, args...)
+}
+
+// feed runs a query listing article summaries along with their hot score, and
+// paginates the results.
+func (m *ArticleModel) feed(ctx context.Context, query string, filters Filters, args ...any) ([]*Article, Metadata, error) {
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
@@ -135,98 +273,91 @@ func (m *ArticleModel) Articles(filters Filters) ([]*Article, Metadata, error) {
 
 	totalRecords := 0
 	var articles []*Article
+	var cursors []Cursor
 
 	for rows.Next() {
 		a := &Article{}
-		var likes int
-		err = rows.Scan(&totalRecords, &a.ID, &a.Title, &a.Content, &a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version, &likes)
+		var hot float64
+		dest := append(append([]any{&totalRecords}, a.summaryFields()...), &hot)
+		err = rows.Scan(dest...)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
-		a.SetURL()
+		a.setSummary()
 
 		articles = append(articles, a)
+		if filters.Keyset {
+			keys := map[string]any{"created_at": a.CreatedAt, "likes": a.Likes, "hot": hot}
+			cursors = append(cursors, filters.cursorAt(keys[filters.sortColumn()], a.ID))
+		}
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
+	if filters.Keyset {
+		articles, metaData := keysetPage(filters, articles, cursors)
+		return articles, metaData, nil
+	}
+
 	metaData := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
 	return articles, metaData, nil
 }
 
-func (m *ArticleModel) SubscribedArticles(filters Filters, user *User) ([]*Article, Metadata, error) {
+// LikesMany returns the likes of the articles, which have to be loaded with
+// their counters, and whether the user has liked them.
+func (m *ArticleModel) LikesMany(ctx context.Context, articles []*Article, user *User) (map[int]*Like, error) {
+	likes := make(map[int]*Like)
+	ids := make([]int64, 0, len(articles))
+
+	for _, article := range articles {
+		likes[article.ID] = &Like{Count: article.Likes}
+		ids = append(ids, int64(article.ID))
+	}
+
+	if user == nil || len(ids) == 0 {
+		return likes, nil
+	}
+
 	query := `
-		SELECT count(*) OVER(), id, title, content, a.publication_id, writer_id, created_at, version, count(al.article_id) as likes
-		FROM subscribes_to st
-		INNER JOIN article a on st.publication_id = a.publication_id
-		LEFT JOIN article_like al on a.id = al.article_id
-		WHERE st.user_id = $1
-		GROUP BY a.id
-		ORDER BY likes DESC, id DESC
-		LIMIT $2 OFFSET $3`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		SELECT article_id
+		FROM article_like
+		WHERE user_id = $1 AND article_id = ANY($2)`
+
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, user.ID, filters.limit(), filters.offset())
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, pq.Array(ids))
 	if err != nil {
-		return nil, Metadata{}, err
+		return nil, err
 	}
 	defer rows.Close()
 
-	totalRecords := 0
-	var articles []*Article
-
 	for rows.Next() {
-		a := &Article{}
-		var likes int
-		err = rows.Scan(&totalRecords, &a.ID, &a.Title, &a.Content, &a.PublicationID, &a.WriterID, &a.CreatedAt, &a.Version, &likes)
+		var id int
+		err = rows.Scan(&id)
 		if err != nil {
-			return nil, Metadata{}, err
+			return nil, err
 		}
-		a.SetURL()
-
-		articles = append(articles, a)
+		likes[id].HasLiked = true
 	}
 
 	if err = rows.Err(); err != nil {
-		return nil, Metadata{}, err
-	}
-
-	metaData := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-
-	return articles, metaData, nil
-}
-
-func (m *ArticleModel) LikesMany(articles []*Article, user *User) (map[int]*Like, error) {
-	likes := make(map[int]*Like)
-
-	for _, article := range articles {
-		if _, ok := likes[article.ID]; ok {
-			continue
-		}
-
-		like, err := m.Likes(article, user)
-
-		if err != nil {
-			return nil, err
-		}
-		likes[article.ID] = like
+		return nil, err
 	}
 
 	return likes, nil
 }
 
-func (m *ArticleModel) Likes(article *Article, user *User) (*Like, error) {
+func (m *ArticleModel) Likes(ctx context.Context, article *Article, user *User) (*Like, error) {
 	query := `
-		SELECT COUNT(*) as likes
-		FROM article_like
-		WHERE article_id = $1`
+		SELECT likes
+		FROM article
+		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, article.ID)
@@ -239,7 +370,7 @@ func (m *ArticleModel) Likes(article *Article, user *User) (*Like, error) {
 		return nil, err
 	}
 
-	like.HasLiked, err = m.UserHasLiked(article, user)
+	like.HasLiked, err = m.UserHasLiked(ctx, article, user)
 	if err != nil {
 		return nil, err
 	}
@@ -247,7 +378,7 @@ func (m *ArticleModel) Likes(article *Article, user *User) (*Like, error) {
 	return like, nil
 }
 
-func (m *ArticleModel) UserHasLiked(article *Article, user *User) (bool, error) {
+func (m *ArticleModel) UserHasLiked(ctx context.Context, article *Article, user *User) (bool, error) {
 	if user == nil || article == nil {
 		return false, nil
 	}
@@ -258,7 +389,7 @@ func (m *ArticleModel) UserHasLiked(article *Article, user *User) (bool, error)
 		WHERE al.user_id = $1 AND al.article_id = $2
 		LIMIT 1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var exists int
@@ -272,12 +403,12 @@ func (m *ArticleModel) UserHasLiked(article *Article, user *User) (bool, error)
 	return exists == 1, nil
 }
 
-func (m *ArticleModel) Comment(article *Article, user *User, comment string) error {
+func (m *ArticleModel) Comment(ctx context.Context, article *Article, user *User, comment string) error {
 	query := `
 		INSERT INTO comment (commenter_id, article_id, content)
 		VALUES ($1, $2, $3)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, user.ID, article.ID, comment)
@@ -287,3 +418,73 @@ func (m *ArticleModel) Comment(article *Article, user *User, comment string) err
 
 	return nil
 }
+
+// RefreshTrending recomputes the hot scores of the articles. Readers keep
+// seeing the previous scores while it runs.
+func (m *ArticleModel) RefreshTrending(ctx context.Context) error {
+	query := `REFRESH MATERIALIZED VIEW CONCURRENTLY article_trending`
+
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReconcileCounters recounts the like and comment counters of the articles,
+// the like counters of the comments and the subscriber counters of the
+// publications, repairing any that have drifted. It returns the number of
+// rows repaired.
+func (m *ArticleModel) ReconcileCounters(ctx context.Context) (int64, error) {
+	queries := []string{
+		`
+		UPDATE article a
+		SET likes = c.likes, comments = c.comments
+		FROM (
+			SELECT id,
+			       (SELECT count(*) FROM article_like WHERE article_id = article.id) as likes,
+			       (SELECT count(*) FROM comment WHERE article_id = article.id) as comments
+			FROM article
+		) c
+		WHERE a.id = c.id AND (a.likes <> c.likes OR a.comments <> c.comments)`,
+		`
+		UPDATE comment cm
+		SET likes = c.likes
+		FROM (
+			SELECT id, (SELECT count(*) FROM comment_like WHERE comment_id = comment.id) as likes
+			FROM comment
+		) c
+		WHERE cm.id = c.id AND cm.likes <> c.likes`,
+		`
+		UPDATE publication p
+		SET subscribers = c.subscribers
+		FROM (
+			SELECT id, (SELECT count(*) FROM subscribes_to WHERE publication_id = publication.id) as subscribers
+			FROM publication
+		) c
+		WHERE p.id = c.id AND p.subscribers <> c.subscribers`,
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancel()
+
+	var repaired int64
+	for _, query := range queries {
+		result, err := m.DB.ExecContext(ctx, query)
+		if err != nil {
+			return repaired, err
+		}
+
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return repaired, err
+		}
+		repaired += rows
+	}
+
+	return repaired, nil
+}
@@ -0,0 +1,112 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+type BookmarkModel struct {
+	DB *DB
+}
+
+func (m *BookmarkModel) Add(ctx context.Context, user *User, article *Article) error {
+	query := `
+		INSERT INTO bookmark (user_id, article_id)
+		VALUES ($1, $2)
+		ON CONFLICT ON CONSTRAINT bookmark_pk DO NOTHING`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, user.ID, article.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *BookmarkModel) Remove(ctx context.Context, user *User, article *Article) error {
+	query := `
+		DELETE FROM bookmark
+		WHERE user_id = $1 AND article_id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, user.ID, article.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *BookmarkModel) Exists(ctx context.Context, user *User, article *Article) (bool, error) {
+	if user == nil || article == nil {
+		return false, nil
+	}
+
+	query := `
+		SELECT 1
+		FROM bookmark
+		WHERE user_id = $1 AND article_id = $2
+		LIMIT 1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var exists int
+	err := m.DB.QueryRowContext(ctx, query, user.ID, article.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+// ForUser returns the bookmarked articles of the user, most recently
+// bookmarked first.
+func (m *BookmarkModel) ForUser(ctx context.Context, user *User, filters Filters) ([]*Article, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT count(*) OVER(), %s
+		FROM bookmark b
+		JOIN article a on a.id = b.article_id
+		WHERE b.user_id = $1
+		ORDER BY b.created_at DESC, a.id DESC
+		LIMIT $2 OFFSET $3`, summaryColumns("a"))
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var articles []*Article
+
+	for rows.Next() {
+		a := &Article{}
+		err = rows.Scan(append([]any{&totalRecords}, a.summaryFields()...)...)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		a.setSummary()
+
+		articles = append(articles, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metaData := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return articles, metaData, nil
+}
@@ -7,7 +7,7 @@ import (
 )
 
 type CommentModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
 type Comment struct {
@@ -19,13 +19,13 @@ type Comment struct {
 	Version     int
 }
 
-func (m *CommentModel) Get(commentID int) (*Comment, error) {
+func (m *CommentModel) Get(ctx context.Context, commentID int) (*Comment, error) {
 	query := `
 		SELECT id, created_at, commenter_id, article_id, content, version
 		FROM comment
 		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, commentID)
@@ -46,13 +46,13 @@ func (m *CommentModel) Get(commentID int) (*Comment, error) {
 	return c, nil
 }
 
-func (m *CommentModel) Count(article *Article) (int, error) {
+func (m *CommentModel) Count(ctx context.Context, article *Article) (int, error) {
 	query := `
-		SELECT COUNT(*)
-		FROM comment
-		WHERE article_id = $1`
+		SELECT comments
+		FROM article
+		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var count int
@@ -66,16 +66,14 @@ func (m *CommentModel) Count(article *Article) (int, error) {
 	return count, nil
 }
 
-func (m *CommentModel) Retrieve(article *Article) ([]*Comment, error) {
+func (m *CommentModel) Retrieve(ctx context.Context, article *Article) ([]*Comment, error) {
 	query := `
-		SELECT id, created_at, commenter_id, article_id, content, version, COUNT(cl.comment_id) as likes
+		SELECT id, created_at, commenter_id, article_id, content, version, likes
 		FROM comment
-		LEFT JOIN comment_like cl on comment.id = cl.comment_id
 		WHERE article_id = $1
-		GROUP BY id
 		ORDER BY likes DESC, id DESC`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	comments := make([]*Comment, 0)
@@ -104,37 +102,7 @@ func (m *CommentModel) Retrieve(article *Article) ([]*Comment, error) {
 	return comments, nil
 }
 
-func (m *CommentModel) Commenters(comments []*Comment, userMap map[int]*User) (map[int]*User, error) {
-	if userMap == nil {
-		userMap = make(map[int]*User, 0)
-	}
-
-	query := `SELECT id, name, email, created_at, image_id FROM users WHERE id = $1`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
-	defer cancel()
-
-	for _, comment := range comments {
-		if _, ok := userMap[comment.CommenterID]; ok {
-			continue
-		}
-
-		s := &User{}
-		err := m.DB.QueryRowContext(ctx, query, comment.CommenterID).Scan(&s.ID, &s.Name, &s.Email, &s.CreatedAt, &s.ImageID)
-
-		if err == sql.ErrNoRows {
-			return nil, ErrRecordNotFound
-		} else if err != nil {
-			return nil, err
-		}
-
-		userMap[s.ID] = s
-	}
-
-	return userMap, nil
-}
-
-func (m *CommentModel) LikesMany(comments []*Comment, user *User) (map[int]*Like, error) {
+func (m *CommentModel) LikesMany(ctx context.Context, comments []*Comment, user *User) (map[int]*Like, error) {
 	likes := make(map[int]*Like)
 
 	for _, comment := range comments {
@@ -142,7 +110,7 @@ func (m *CommentModel) LikesMany(comments []*Comment, user *User) (map[int]*Like
 			continue
 		}
 
-		like, err := m.Likes(comment, user)
+		like, err := m.Likes(ctx, comment, user)
 
 		if err != nil {
 			return nil, err
@@ -153,13 +121,13 @@ func (m *CommentModel) LikesMany(comments []*Comment, user *User) (map[int]*Like
 	return likes, nil
 }
 
-func (m *CommentModel) Likes(comment *Comment, user *User) (*Like, error) {
+func (m *CommentModel) Likes(ctx context.Context, comment *Comment, user *User) (*Like, error) {
 	query := `
-		SELECT COUNT(*) as likes
-		FROM comment_like
-		WHERE comment_id = $1`
+		SELECT likes
+		FROM comment
+		WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, comment.ID)
@@ -172,7 +140,7 @@ func (m *CommentModel) Likes(comment *Comment, user *User) (*Like, error) {
 		return nil, err
 	}
 
-	like.HasLiked, err = m.UserHasLiked(comment, user)
+	like.HasLiked, err = m.UserHasLiked(ctx, comment, user)
 	if err != nil {
 		return nil, err
 	}
@@ -180,7 +148,7 @@ func (m *CommentModel) Likes(comment *Comment, user *User) (*Like, error) {
 	return like, nil
 }
 
-func (m *CommentModel) UserHasLiked(comment *Comment, user *User) (bool, error) {
+func (m *CommentModel) UserHasLiked(ctx context.Context, comment *Comment, user *User) (bool, error) {
 	if user == nil || comment == nil {
 		return false, nil
 	}
@@ -191,7 +159,7 @@ func (m *CommentModel) UserHasLiked(comment *Comment, user *User) (bool, error)
 		WHERE user_id = $1 AND comment_id = $2
 		LIMIT 1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var exists int
@@ -204,22 +172,3 @@ func (m *CommentModel) UserHasLiked(comment *Comment, user *User) (bool, error)
 
 	return exists == 1, nil
 }
-
-func (m *CommentModel) Counts(articles []*Article) (map[int]int, error) {
-	counts := make(map[int]int)
-
-	for _, article := range articles {
-		if _, ok := counts[article.ID]; ok {
-			continue
-		}
-
-		count, err := m.Count(article)
-
-		if err != nil {
-			return nil, err
-		}
-		counts[article.ID] = count
-	}
-
-	return counts, nil
-}
@@ -0,0 +1,121 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a keyset paginated listing: the sort key and
+// id of the row next to the page it points at.
+type Cursor struct {
+	Sort     string `json:"s"`
+	Key      string `json:"k"`
+	ID       int    `json:"i"`
+	Backward bool   `json:"b,omitempty"`
+}
+
+// Sign encodes the cursor into an opaque string that can be handed to
+// clients, signed with the secret so that they can't forge their own.
+func (c Cursor) Sign(secret []byte) string {
+	payload, _ := json.Marshal(c)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+
+	encoding := base64.RawURLEncoding
+	return encoding.EncodeToString(payload) + "." + encoding.EncodeToString(mac.Sum(nil))
+}
+
+// ParseCursor decodes a cursor created by Sign, returning ErrInvalidCursor
+// if it is malformed or has not been signed with the secret.
+func ParseCursor(s string, secret []byte) (*Cursor, error) {
+	encoding := base64.RawURLEncoding
+
+	payloadStr, sumStr, ok := strings.Cut(s, ".")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := encoding.DecodeString(payloadStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sum, err := encoding.DecodeString(sumStr)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &Cursor{}
+	err = json.Unmarshal(payload, c)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	return c, nil
+}
+
+// cursorKey formats a sort key so that PostgreSQL reads back the exact same
+// value.
+func cursorKey(key any) string {
+	switch k := key.(type) {
+	case time.Time:
+		return k.Format(time.RFC3339Nano)
+	case float64:
+		return strconv.FormatFloat(k, 'g', -1, 64)
+	case int:
+		return strconv.Itoa(k)
+	}
+
+	panic("unsupported cursor key")
+}
+
+// keysetPage trims the extra row fetched by a keyset paginated query and
+// returns the rows in display order along with the cursors to the pages
+// around them. cursors holds the cursor of each row.
+func keysetPage[T any](f Filters, rows []T, cursors []Cursor) ([]T, Metadata) {
+	more := len(rows) > f.PageSize
+	if more {
+		rows = rows[:f.PageSize]
+		cursors = cursors[:f.PageSize]
+	}
+
+	backward := f.Cursor != nil && f.Cursor.Backward
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+			cursors[i], cursors[j] = cursors[j], cursors[i]
+		}
+	}
+
+	metaData := Metadata{Keyset: true, PageSize: f.PageSize}
+	if len(rows) == 0 {
+		return rows, metaData
+	}
+
+	// going backward the cursor came from the next page, going forward from
+	// the previous one
+	if more || backward {
+		next := cursors[len(cursors)-1]
+		metaData.Next = &next
+	}
+	if backward && more || !backward && f.Cursor != nil {
+		prev := cursors[0]
+		prev.Backward = true
+		metaData.Prev = &prev
+	}
+
+	return rows, metaData
+}
@@ -0,0 +1,77 @@
+package data
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	secret := []byte("secret")
+
+	for _, c := range []Cursor{
+		{Sort: "-created_at", Key: "2022-05-01T10:00:00.123456Z", ID: 42},
+		{Sort: "-likes", Key: "0", ID: 1, Backward: true},
+		{Sort: "-hot", Key: "1.5e-07", ID: 7},
+	} {
+		got, err := ParseCursor(c.Sign(secret), secret)
+		if err != nil {
+			t.Errorf("ParseCursor(Sign(%+v)) failed: %v", c, err)
+			continue
+		}
+		if *got != c {
+			t.Errorf("ParseCursor(Sign(%+v)) = %+v", c, *got)
+		}
+	}
+}
+
+func TestParseCursorRejects(t *testing.T) {
+	secret := []byte("secret")
+	signed := Cursor{Sort: "-likes", Key: "10", ID: 3}.Sign(secret)
+	payload, sum, _ := strings.Cut(signed, ".")
+
+	encoding := base64.RawURLEncoding
+	forged := encoding.EncodeToString([]byte(`{"s":"-likes","k":"10","i":4}`)) + "." + sum
+	unsigned := encoding.EncodeToString([]byte(`{"s":"-likes","k":"10","i":3}`))
+
+	tamperedSum := []byte(sum)
+	if tamperedSum[0] == 'A' {
+		tamperedSum[0] = 'B'
+	} else {
+		tamperedSum[0] = 'A'
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		secret string
+	}{
+		{"other secret", signed, "other"},
+		{"forged payload", forged, "secret"},
+		{"tampered signature", payload + "." + string(tamperedSum), "secret"},
+		{"no signature", unsigned, "secret"},
+		{"empty signature", payload + ".", "secret"},
+		{"bad encoding", payload + ".!!", "secret"},
+		{"empty", "", "secret"},
+		{"not json", encoding.EncodeToString([]byte("x")) + "." + signOf("x", "secret"), "secret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseCursor(tt.cursor, []byte(tt.secret))
+			if err != ErrInvalidCursor {
+				t.Errorf("ParseCursor(%q) = %+v, %v, want ErrInvalidCursor", tt.cursor, c, err)
+			}
+		})
+	}
+}
+
+// signOf returns the encoded signature of an arbitrary payload, to check
+// that validly signed garbage is rejected too.
+func signOf(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
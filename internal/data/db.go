@@ -0,0 +1,181 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// DB is the database the models run their queries on. It bounds the queries
+// of a model method with a deadline and logs the queries that take longer
+// than SlowQuery, naming them after the method that ran them.
+type DB struct {
+	*sql.DB
+
+	// Timeout is the deadline of a model method, on top of the deadline of
+	// the context it is called with. Zero leaves only the latter.
+	Timeout time.Duration
+	// SlowQuery is the duration above which queries are logged. Zero turns
+	// logging off.
+	SlowQuery time.Duration
+	Logger    *log.Logger
+}
+
+// timeout derives the context of a model method from the one it is called
+// with.
+func (db *DB) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.Timeout)
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	countQuery(ctx)
+	defer db.logSlow(time.Now())
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	countQuery(ctx)
+	defer db.logSlow(time.Now())
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	countQuery(ctx)
+	defer db.logSlow(time.Now())
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+// Tx is a transaction begun on a DB, whose queries are counted and logged
+// like the queries of the DB.
+type Tx struct {
+	*sql.Tx
+	db *DB
+}
+
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	tx, err := db.DB.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, db: db}, nil
+}
+
+func (tx *Tx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	countQuery(ctx)
+	defer tx.db.logSlow(time.Now())
+	return tx.Tx.QueryContext(ctx, query, args...)
+}
+
+func (tx *Tx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	countQuery(ctx)
+	defer tx.db.logSlow(time.Now())
+	return tx.Tx.QueryRowContext(ctx, query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	countQuery(ctx)
+	defer tx.db.logSlow(time.Now())
+	return tx.Tx.ExecContext(ctx, query, args...)
+}
+
+// QueryCounter counts the queries run with a context it was added to by
+// WithQueryCounter.
+type QueryCounter struct {
+	n int64
+}
+
+// Count returns the number of queries counted so far.
+func (c *QueryCounter) Count() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+type queryCounterKey struct{}
+
+// WithQueryCounter returns a context in which the queries run, with it or a
+// context derived from it, are counted by the counter returned.
+func WithQueryCounter(ctx context.Context) (context.Context, *QueryCounter) {
+	c := &QueryCounter{}
+	return context.WithValue(ctx, queryCounterKey{}, c), c
+}
+
+func countQuery(ctx context.Context) {
+	if c, ok := ctx.Value(queryCounterKey{}).(*QueryCounter); ok {
+		atomic.AddInt64(&c.n, 1)
+	}
+}
+
+// logSlow logs the query started at start if it has been slow, naming it
+// after the model method that ran it.
+func (db *DB) logSlow(start time.Time) {
+	if db.SlowQuery <= 0 || db.Logger == nil {
+		return
+	}
+
+	elapsed := time.Since(start)
+	if elapsed < db.SlowQuery {
+		return
+	}
+
+	db.Logger.Printf("slow query %s took %s", queryName(), elapsed)
+}
+
+// queryName returns the name of the model method up the call stack that ran
+// the query, such as "ArticleModel.Get". It is the first exported method of
+// the package, which skips the query methods of DB and Tx as well as the
+// unexported helpers model methods share, like UserModel.follows.
+func queryName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if name, ok := modelMethod(frame.Function); ok {
+			return name
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// modelMethod returns the type and method of a function of the package,
+// named like "blogalusta/internal/data.(*ArticleModel).Get", if it is an
+// exported method other than a query method of DB and Tx. Function
+// literals inside a method, like "(*ArticleModel).Get.func1", count as the
+// method.
+func modelMethod(function string) (string, bool) {
+	name := function[strings.LastIndex(function, "/")+1:]
+	if !strings.HasPrefix(name, "data.(") {
+		return "", false
+	}
+	name = strings.NewReplacer("(", "", ")", "", "*", "").Replace(strings.TrimPrefix(name, "data."))
+
+	parts := strings.Split(name, ".")
+	if len(parts) < 2 || parts[1] == "" || !unicode.IsUpper(rune(parts[1][0])) {
+		return "", false
+	}
+	if (parts[0] == "DB" || parts[0] == "Tx") && queryMethods[parts[1]] {
+		return "", false
+	}
+	return parts[0] + "." + parts[1], true
+}
+
+// queryMethods are the methods of DB and Tx that run queries for the
+// models.
+var queryMethods = map[string]bool{"QueryContext": true, "QueryRowContext": true, "ExecContext": true}
+
+// Notify sends the payload to the listeners of the channel.
+func (db *DB) Notify(ctx context.Context, channel, payload string) error {
+	ctx, cancel := db.timeout(ctx)
+	defer cancel()
+
+	_, err := db.ExecContext(ctx, `SELECT pg_notify($1, $2)`, channel, payload)
+	return err
+}
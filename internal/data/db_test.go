@@ -0,0 +1,43 @@
+package data
+
+import "testing"
+
+func TestModelMethod(t *testing.T) {
+	tests := []struct {
+		function string
+		want     string
+		ok       bool
+	}{
+		{"blogalusta/internal/data.(*ArticleModel).Get", "ArticleModel.Get", true},
+		{"blogalusta/internal/data.(*ArticleModel).Get.func1", "ArticleModel.Get", true},
+		{"blogalusta/internal/data.(*DB).Notify", "DB.Notify", true},
+		{"blogalusta/internal/data.(*UserModel).follows", "", false},
+		{"blogalusta/internal/data.(*DB).QueryContext", "", false},
+		{"blogalusta/internal/data.(*Tx).ExecContext", "", false},
+		{"blogalusta/internal/data.countQuery", "", false},
+		{"main.(*application).handleGetArticle", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := modelMethod(tt.function)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("modelMethod(%q) = %q, %v, want %q, %v", tt.function, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+type testModel struct{}
+
+func (m *testModel) Get() string {
+	return m.helper()
+}
+
+func (m *testModel) helper() string {
+	return queryName()
+}
+
+func TestQueryNameSkipsHelpers(t *testing.T) {
+	if got := (&testModel{}).Get(); got != "testModel.Get" {
+		t.Errorf("queryName() = %q, want %q", got, "testModel.Get")
+	}
+}
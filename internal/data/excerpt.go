@@ -0,0 +1,74 @@
+package data
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const excerptLength = 200
+
+// wordsPerMinute is the reading speed reading times are estimated with.
+const wordsPerMinute = 200
+
+var (
+	excerptCodeBlock = regexp.MustCompile("(?s)```.*?(```|$)")
+	excerptImage     = regexp.MustCompile(`!\[[^\]]*\]\([^)]*\)`)
+	excerptLink      = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	excerptTag       = regexp.MustCompile(`<[^>]*>`)
+	excerptLineStart = regexp.MustCompile(`(?m)^\s*(#{1,6}|>|[-*+]|\d+\.)\s+`)
+	excerptEmphasis  = regexp.MustCompile("[*_~`]+")
+
+	firstImage = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)`)
+)
+
+// plainText strips the Markdown syntax off an article, leaving the words of
+// its prose separated by single spaces. Code blocks are left out.
+func plainText(markdown string) string {
+	text := excerptCodeBlock.ReplaceAllString(markdown, " ")
+	text = excerptImage.ReplaceAllString(text, " ")
+	text = excerptLink.ReplaceAllString(text, "$1")
+	text = excerptTag.ReplaceAllString(text, " ")
+	text = excerptLineStart.ReplaceAllString(text, "")
+	text = excerptEmphasis.ReplaceAllString(text, "")
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// excerpt strips the Markdown syntax off the start of an article and cuts it
+// down to a short plain text teaser.
+func excerpt(markdown string) string {
+	text := plainText(markdown)
+
+	if utf8.RuneCountInString(text) <= excerptLength {
+		return text
+	}
+
+	runes := []rune(text)[:excerptLength]
+	cut := string(runes)
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+
+	return strings.TrimRight(cut, ",.;:!?-") + "…"
+}
+
+// setMetadata computes what is stored along the content of the article: the
+// words of its prose and the minutes they take to read, and the excerpt and
+// the cover, from the start and the first image of the content, unless the
+// writer gave them.
+func (a *Article) setMetadata() {
+	a.WordCount = len(strings.Fields(plainText(a.Content)))
+	a.ReadingTime = (a.WordCount + wordsPerMinute - 1) / wordsPerMinute
+	if a.ReadingTime < 1 {
+		a.ReadingTime = 1
+	}
+
+	if strings.TrimSpace(a.Excerpt) == "" {
+		a.Excerpt = excerpt(a.Content)
+	}
+	if a.Cover == "" {
+		if m := firstImage.FindStringSubmatch(a.Content); m != nil {
+			a.Cover = m[1]
+		}
+	}
+}
@@ -1,8 +1,11 @@
 package data
 
 import (
+	"database/sql"
+	"fmt"
 	"math"
 	"strings"
+	"time"
 )
 
 type Filters struct {
@@ -10,6 +13,14 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	// Since limits the results to records created after it, unless zero.
+	Since time.Time
+	// Until limits the results to records created before it, unless zero.
+	Until time.Time
+	// Keyset pages through the results with cursors instead of page numbers,
+	// starting after Cursor if it is set.
+	Keyset bool
+	Cursor *Cursor
 }
 
 type Metadata struct {
@@ -18,6 +29,17 @@ type Metadata struct {
 	FirstPage    int
 	LastPage     int
 	TotalRecords int
+
+	// set instead of the page numbers with keyset pagination
+	Keyset bool
+	Next   *Cursor
+	Prev   *Cursor
+}
+
+// sortKeyTypes holds the types of the sort columns that aren't numeric, so
+// that cursor keys can be cast back to them.
+var sortKeyTypes = map[string]string{
+	"created_at": "timestamptz",
 }
 
 func (f *Filters) sortColumn() string {
@@ -38,11 +60,88 @@ func (f Filters) sortDirection() string {
 	return "ASC"
 }
 
+// keyset returns the condition selecting the rows past the cursor, with the
+// arguments of the query starting at $n. table is the alias of the table
+// holding the sort column and id.
+func (f *Filters) keyset(table string, n int) string {
+	if f.Cursor == nil {
+		return "TRUE"
+	}
+
+	column := f.sortColumn()
+	keyType, ok := sortKeyTypes[column]
+	if !ok {
+		keyType = "numeric"
+	}
+
+	op := "<"
+	if (f.sortDirection() == "ASC") != f.Cursor.Backward {
+		op = ">"
+	}
+
+	return fmt.Sprintf("(%s.%s, %s.id) %s ($%d::%s, $%d)", table, column, table, op, n, keyType, n+1)
+}
+
+func (f Filters) keysetArgs() []any {
+	if f.Cursor == nil {
+		return nil
+	}
+
+	return []any{f.Cursor.Key, f.Cursor.ID}
+}
+
+// orderBy returns the ORDER BY clause of the sort column, with the id to
+// break ties. Keyset pages before the cursor are fetched in reverse.
+func (f *Filters) orderBy(table string) string {
+	direction := f.sortDirection()
+	if f.Cursor != nil && f.Cursor.Backward {
+		if direction == "ASC" {
+			direction = "DESC"
+		} else {
+			direction = "ASC"
+		}
+	}
+
+	return fmt.Sprintf("%s.%s %s, %s.id %s", table, f.sortColumn(), direction, table, direction)
+}
+
+// cursorAt returns the cursor of a row with the given sort key and id.
+func (f Filters) cursorAt(key any, id int) Cursor {
+	return Cursor{Sort: f.Sort, Key: cursorKey(key), ID: id}
+}
+
+// totalRecords returns the expression counting all the results, which keyset
+// pagination does without.
+func (f Filters) totalRecords() string {
+	if f.Keyset {
+		return "0"
+	}
+
+	return "count(*) OVER()"
+}
+
+func (f Filters) since() sql.NullTime {
+	return sql.NullTime{Time: f.Since, Valid: !f.Since.IsZero()}
+}
+
+func (f Filters) until() sql.NullTime {
+	return sql.NullTime{Time: f.Until, Valid: !f.Until.IsZero()}
+}
+
 func (f Filters) limit() int {
+	// keyset pagination fetches one more row to tell if there is a next page
+	if f.Keyset {
+		return f.PageSize + 1
+	}
+
 	return f.PageSize
 }
 
 func (f Filters) offset() int {
+	if f.Keyset {
+		return 0
+	}
+
 	return (f.Page - 1) * f.PageSize
 }
 
@@ -0,0 +1,108 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeysetPage(t *testing.T) {
+	at := func(id int) Cursor { return Cursor{Sort: "-likes", Key: "0", ID: id} }
+	back := func(id int) *Cursor {
+		c := at(id)
+		c.Backward = true
+		return &c
+	}
+	fwd := func(id int) *Cursor {
+		c := at(id)
+		return &c
+	}
+
+	tests := []struct {
+		name   string
+		cursor *Cursor
+		// rows as fetched, in reverse when going backward
+		rows     []int
+		want     []int
+		wantNext *Cursor
+		wantPrev *Cursor
+	}{
+		{"empty", nil, nil, nil, nil, nil},
+		{"single page", nil, []int{1, 2}, []int{1, 2}, nil, nil},
+		{"first page", nil, []int{1, 2, 3}, []int{1, 2}, fwd(2), nil},
+		{"middle page", fwd(2), []int{3, 4, 5}, []int{3, 4}, fwd(4), back(3)},
+		{"last page", fwd(4), []int{5}, []int{5}, nil, back(5)},
+		{"past the last page", fwd(5), nil, nil, nil, nil},
+		{"back to a middle page", back(5), []int{4, 3, 2}, []int{3, 4}, fwd(4), back(3)},
+		{"back to the first page", back(3), []int{2, 1}, []int{1, 2}, fwd(2), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{PageSize: 2, Sort: "-likes", Keyset: true, Cursor: tt.cursor}
+
+			rows := append([]int(nil), tt.rows...)
+			cursors := make([]Cursor, len(rows))
+			for i, id := range rows {
+				cursors[i] = at(id)
+			}
+
+			got, meta := keysetPage(f, rows, cursors)
+
+			if len(got) != len(tt.want) || len(got) > 0 && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+			if !meta.Keyset || meta.PageSize != 2 {
+				t.Errorf("metadata = %+v, want a keyset page of 2", meta)
+			}
+			if !reflect.DeepEqual(meta.Next, tt.wantNext) {
+				t.Errorf("next = %+v, want %+v", meta.Next, tt.wantNext)
+			}
+			if !reflect.DeepEqual(meta.Prev, tt.wantPrev) {
+				t.Errorf("prev = %+v, want %+v", meta.Prev, tt.wantPrev)
+			}
+		})
+	}
+}
+
+func TestKeysetQuery(t *testing.T) {
+	tests := []struct {
+		name        string
+		sort        string
+		cursor      *Cursor
+		wantKeyset  string
+		wantOrderBy string
+	}{
+		{"no cursor", "-likes", nil,
+			"TRUE", "a.likes DESC, a.id DESC"},
+		{"forward descending", "-likes", &Cursor{},
+			"(a.likes, a.id) < ($3::numeric, $4)", "a.likes DESC, a.id DESC"},
+		{"backward descending", "-likes", &Cursor{Backward: true},
+			"(a.likes, a.id) > ($3::numeric, $4)", "a.likes ASC, a.id ASC"},
+		{"forward ascending", "created_at", &Cursor{},
+			"(a.created_at, a.id) > ($3::timestamptz, $4)", "a.created_at ASC, a.id ASC"},
+		{"backward ascending", "created_at", &Cursor{Backward: true},
+			"(a.created_at, a.id) < ($3::timestamptz, $4)", "a.created_at DESC, a.id DESC"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := Filters{
+				PageSize:     10,
+				Sort:         tt.sort,
+				SortSafeList: []string{"-likes", "created_at"},
+				Keyset:       true,
+				Cursor:       tt.cursor,
+			}
+
+			if got := f.keyset("a", 3); got != tt.wantKeyset {
+				t.Errorf("keyset() = %q, want %q", got, tt.wantKeyset)
+			}
+			if got := f.orderBy("a"); got != tt.wantOrderBy {
+				t.Errorf("orderBy() = %q, want %q", got, tt.wantOrderBy)
+			}
+			if f.limit() != 11 || f.offset() != 0 || f.totalRecords() != "0" {
+				t.Errorf("limit, offset, total = %d, %d, %s, want 11, 0, 0", f.limit(), f.offset(), f.totalRecords())
+			}
+		})
+	}
+}
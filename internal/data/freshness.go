@@ -0,0 +1,146 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Freshness describes the state of the data shown on a page, for validating
+// cached copies of it. Tag changes whenever something on the page does,
+// including deletions, and LastModified is the latest change that left a
+// timestamp behind.
+type Freshness struct {
+	Tag          string
+	LastModified time.Time
+}
+
+// Freshness returns the freshness of the page of the article: its content,
+// likes and comments, and the names of the people on it.
+func (m *ArticleModel) Freshness(ctx context.Context, article *Article) (*Freshness, error) {
+	query := `
+		SELECT a.version, a.likes, a.comments, p.version, w.version,
+		       (SELECT coalesce(sum(c.likes), 0) FROM comment c WHERE c.article_id = a.id),
+		       (SELECT coalesce(sum(u.version), 0)
+		        FROM comment c
+		        JOIN users u ON u.id = c.commenter_id
+		        WHERE c.article_id = a.id),
+		       greatest(a.created_at,
+		                (SELECT max(c.created_at) FROM comment c WHERE c.article_id = a.id),
+		                (SELECT max(al.created_at) FROM article_like al WHERE al.article_id = a.id),
+		                (SELECT max(cl.created_at)
+		                 FROM comment_like cl
+		                 JOIN comment c ON c.id = cl.comment_id
+		                 WHERE c.article_id = a.id))
+		FROM article a
+		JOIN publication p ON p.id = a.publication_id
+		JOIN users w ON w.id = a.writer_id
+		WHERE a.id = $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var version, likes, comments, pubVersion, writerVersion, commentLikes, commenterVersions int
+	f := &Freshness{}
+	err := m.DB.QueryRowContext(ctx, query, article.ID).Scan(&version, &likes, &comments, &pubVersion,
+		&writerVersion, &commentLikes, &commenterVersions, &f.LastModified)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	f.Tag = fmt.Sprintf("a%d.%d.%d.%d.%d.%d.%d.%d.%d", article.ID, version, likes, comments, pubVersion,
+		writerVersion, commentLikes, commenterVersions, f.LastModified.Unix())
+
+	return f, nil
+}
+
+// Freshness returns the freshness of the pages of the publication: its
+// details, writers and the summaries of its articles.
+func (m *PublicationModel) Freshness(ctx context.Context, publication *Publication) (*Freshness, error) {
+	query := `
+		SELECT p.version, count(a.id), coalesce(sum(a.version), 0),
+		       coalesce(sum(a.likes), 0), coalesce(sum(a.comments), 0),
+		       (SELECT count(*) || '.' || coalesce(sum(u.version), 0)
+		        FROM writes_on wo
+		        JOIN users u ON u.id = wo.user_id
+		        WHERE wo.publication_id = p.id),
+		       greatest(p.created_at, max(a.created_at),
+		                (SELECT max(al.created_at)
+		                 FROM article_like al
+		                 JOIN article pa ON pa.id = al.article_id
+		                 WHERE pa.publication_id = p.id),
+		                (SELECT max(c.created_at)
+		                 FROM comment c
+		                 JOIN article pa ON pa.id = c.article_id
+		                 WHERE pa.publication_id = p.id))
+		FROM publication p
+		LEFT JOIN article a ON a.publication_id = p.id
+		WHERE p.id = $1
+		GROUP BY p.id`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var version, articles, articleVersions, likes, comments int
+	var writers string
+	f := &Freshness{}
+	err := m.DB.QueryRowContext(ctx, query, publication.ID).Scan(&version, &articles, &articleVersions,
+		&likes, &comments, &writers, &f.LastModified)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	f.Tag = fmt.Sprintf("p%d.%d.%d.%d.%d.%d.%s.%d", publication.ID, version, articles, articleVersions,
+		likes, comments, writers, f.LastModified.Unix())
+
+	return f, nil
+}
+
+// Freshness returns the freshness of the profile page of the user: their
+// details, follows, publications and public reading lists.
+func (m *UserModel) Freshness(ctx context.Context, user *User) (*Freshness, error) {
+	query := `
+		SELECT u.version,
+		       (SELECT count(*) FROM follows WHERE followee_id = u.id),
+		       (SELECT count(*) FROM follows WHERE follower_id = u.id),
+		       (SELECT count(*) || '.' || coalesce(sum(p.version), 0)
+		        FROM writes_on wo
+		        JOIN publication p ON p.id = wo.publication_id
+		        WHERE wo.user_id = u.id),
+		       (SELECT count(*) || '.' || coalesce(sum(p.version), 0)
+		        FROM subscribes_to st
+		        JOIN publication p ON p.id = st.publication_id
+		        WHERE st.user_id = u.id),
+		       (SELECT count(*) || '.' || coalesce(sum(rl.version), 0)
+		        FROM reading_list rl
+		        WHERE rl.user_id = u.id AND rl.public),
+		       greatest(u.created_at,
+		                (SELECT max(created_at) FROM follows WHERE followee_id = u.id OR follower_id = u.id),
+		                (SELECT max(rl.created_at) FROM reading_list rl WHERE rl.user_id = u.id))
+		FROM users u
+		WHERE u.id = $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var version, followers, following int
+	var writesOn, subscribesTo, lists string
+	f := &Freshness{}
+	err := m.DB.QueryRowContext(ctx, query, user.ID).Scan(&version, &followers, &following,
+		&writesOn, &subscribesTo, &lists, &f.LastModified)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	f.Tag = fmt.Sprintf("u%d.%d.%d.%d.%s.%s.%s.%d", user.ID, version, followers, following,
+		writesOn, subscribesTo, lists, f.LastModified.Unix())
+
+	return f, nil
+}
@@ -3,24 +3,76 @@ package data
 import (
 	"context"
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
 )
 
+// Image is an uploaded image. Images are never changed, a new upload makes a
+// new image, so their content hash can name them in URLs. The content is
+// kept in blob storage under the key of the hash, uploads of the same
+// content share one image.
+type Image struct {
+	ID          int
+	Hash        string
+	ContentType string
+	Width       int
+	Height      int
+	Size        int
+	OwnerID     sql.NullInt64
+
+	// Data is the content of an image that was stored in the database
+	// before blob storage, nil once it has been moved.
+	Data []byte
+}
+
+// ImageVariant is a resized copy of an image still stored in the database.
+type ImageVariant struct {
+	ImageID     int
+	Hash        string
+	Size        int
+	ContentType string
+	Data        []byte
+}
+
+// PublicationImage is an image uploaded to the media library of a
+// publication for its articles.
+type PublicationImage struct {
+	Image      *Image
+	Alt        string
+	UploaderID sql.NullInt64
+	CreatedAt  time.Time
+}
+
+// ImageKey returns the blob storage key of the image with the content hash.
+// Keys are spread over directories by the first bytes of the hash.
+func ImageKey(hash string) string {
+	return fmt.Sprintf("images/%s/%s", hash[:2], hash)
+}
+
+// VariantKey returns the blob storage key of the image with the content
+// hash resized to size in the content type.
+func VariantKey(hash string, size int, contentType string) string {
+	return fmt.Sprintf("variants/%s/%s-%d.%s", hash[:2], hash, size, strings.TrimPrefix(contentType, "image/"))
+}
+
 type ImageModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (m *ImageModel) Get(id int) ([]byte, error) {
+// GetByHash returns the image with the content hash.
+func (m *ImageModel) GetByHash(ctx context.Context, hash string) (*Image, error) {
 	query := `
-		SELECT image_data
+		SELECT id, hash, content_type, width, height, byte_size, owner_id, image_data
 		FROM image
-		WHERE id = $1`
+		WHERE hash = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	var image []byte
-	err := m.DB.QueryRowContext(ctx, query, id).Scan(&image)
+	image := &Image{}
+	err := m.DB.QueryRowContext(ctx, query, hash).Scan(&image.ID, &image.Hash, &image.ContentType, &image.Width,
+		&image.Height, &image.Size, &image.OwnerID, &image.Data)
 	if err == sql.ErrNoRows {
 		return nil, ErrRecordNotFound
 	} else if err != nil {
@@ -30,20 +82,299 @@ func (m *ImageModel) Get(id int) ([]byte, error) {
 	return image, nil
 }
 
-func (m *ImageModel) Insert(image []byte) (int, error) {
+// Hash returns the content hash of the image with the id.
+func (m *ImageModel) Hash(ctx context.Context, id int) (string, error) {
 	query := `
-		INSERT INTO image (image_data)
-		VALUES ($1)
+		SELECT hash
+		FROM image
+		WHERE id = $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var hash string
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&hash)
+	if err == sql.ErrNoRows {
+		return "", ErrRecordNotFound
+	} else if err != nil {
+		return "", err
+	}
+
+	return hash, nil
+}
+
+// Insert records an image and sets its id, before its content is put in
+// blob storage. An image with the same content hash is reused, keeping its
+// owner, and is kept from the sweeper for another grace period.
+func (m *ImageModel) Insert(ctx context.Context, image *Image) error {
+	query := `
+		INSERT INTO image (hash, content_type, width, height, byte_size, owner_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (hash) DO UPDATE SET created_at = now()
 		RETURNING id`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	id := 0
-	err := m.DB.QueryRowContext(ctx, query, image).Scan(&id)
+	args := []any{image.Hash, image.ContentType, image.Width, image.Height, image.Size, image.OwnerID}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&image.ID)
+}
+
+// InsertVariant records a generated variant of the image whose content has
+// been put in blob storage, keeping the record already there if another
+// request generated it first.
+func (m *ImageModel) InsertVariant(ctx context.Context, image *Image, size int, contentType string, byteSize int) error {
+	query := `
+		INSERT INTO image_variant (image_id, size, content_type, byte_size)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ON CONSTRAINT image_variant_pk DO NOTHING`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, image.ID, size, contentType, byteSize)
+	return err
+}
+
+// AddToPublication adds the image to the media library of the publication.
+// Uploading an image that is already there moves it to the top, and replaces
+// its alt text unless the new one is empty.
+func (m *ImageModel) AddToPublication(ctx context.Context, publication *Publication, image *Image, uploader *User, alt string) error {
+	query := `
+		INSERT INTO publication_image (publication_id, image_id, uploader_id, alt)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT ON CONSTRAINT publication_image_pk DO UPDATE
+			SET created_at = now(),
+			    alt        = CASE WHEN EXCLUDED.alt = '' THEN publication_image.alt ELSE EXCLUDED.alt END`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, publication.ID, image.ID, uploader.ID, alt)
+	return err
+}
+
+// ForPublication returns the media library of the publication, the latest
+// uploads first.
+func (m *ImageModel) ForPublication(ctx context.Context, publication *Publication) ([]*PublicationImage, error) {
+	query := `
+		SELECT i.id, i.hash, i.content_type, i.width, i.height, i.byte_size, pi.alt, pi.uploader_id, pi.created_at
+		FROM publication_image pi
+		JOIN image i ON i.id = pi.image_id
+		WHERE pi.publication_id = $1
+		ORDER BY pi.created_at DESC, i.id DESC`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, publication.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*PublicationImage
+	for rows.Next() {
+		pi := &PublicationImage{Image: &Image{}}
+		err = rows.Scan(&pi.Image.ID, &pi.Image.Hash, &pi.Image.ContentType, &pi.Image.Width, &pi.Image.Height,
+			&pi.Image.Size, &pi.Alt, &pi.UploaderID, &pi.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, pi)
+	}
+
+	return images, rows.Err()
+}
+
+// DeleteUnreferenced deletes up to limit images older than the grace period
+// that no user, past avatar, media library, article or article cover refers
+// to. The blobs of each image are deleted by deleteBlobs before its row,
+// while the row is locked, so that an upload of the same content waits and
+// stores its blob again afterwards. It returns the images deleted.
+//
+// Deleting blobs takes longer than queries, so it runs under the deadline of
+// ctx alone rather than the timeout of the models. If the transaction fails
+// after some blobs are gone, their rows stay unreferenced and are deleted
+// again by the next sweep, for which blobs already gone are deleted too.
+func (m *ImageModel) DeleteUnreferenced(ctx context.Context, grace time.Duration, limit int,
+	deleteBlobs func(image *Image, variants []*ImageVariant) error) ([]*Image, error) {
+	query := `
+		SELECT i.id, i.hash
+		FROM image i
+		WHERE i.created_at < now() - make_interval(secs => $1)
+		  AND NOT EXISTS (SELECT 1 FROM users u WHERE u.image_id = i.id)
+		  AND NOT EXISTS (SELECT 1 FROM user_avatar ua WHERE ua.image_id = i.id)
+		  AND NOT EXISTS (SELECT 1 FROM publication_image pi WHERE pi.image_id = i.id)
+		  AND NOT EXISTS (SELECT 1 FROM article a WHERE strpos(a.content, i.hash) > 0)
+		  AND NOT EXISTS (SELECT 1 FROM article a WHERE strpos(a.cover, i.hash) > 0)
+		ORDER BY i.id
+		LIMIT $2
+		FOR UPDATE OF i SKIP LOCKED`
+
+	tx, err := m.DB.BeginTx(ctx, nil)
 	if err != nil {
-		return 0, err
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, grace.Seconds(), limit)
+	if err != nil {
+		return nil, err
 	}
 
-	return id, nil
+	var images []*Image
+	for rows.Next() {
+		image := &Image{}
+		err = rows.Scan(&image.ID, &image.Hash)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		images = append(images, image)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, image := range images {
+		variants, err := m.variants(ctx, tx, image)
+		if err != nil {
+			return nil, err
+		}
+
+		err = deleteBlobs(image, variants)
+		if err != nil {
+			return nil, err
+		}
+
+		// the variants go along with the image
+		_, err = tx.ExecContext(ctx, `DELETE FROM image WHERE id = $1`, image.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return images, tx.Commit()
+}
+
+func (m *ImageModel) variants(ctx context.Context, tx *Tx, image *Image) ([]*ImageVariant, error) {
+	query := `
+		SELECT size, content_type
+		FROM image_variant
+		WHERE image_id = $1`
+
+	rows, err := tx.QueryContext(ctx, query, image.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []*ImageVariant
+	for rows.Next() {
+		v := &ImageVariant{ImageID: image.ID, Hash: image.Hash}
+		err = rows.Scan(&v.Size, &v.ContentType)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+
+	return variants, rows.Err()
+}
+
+// Unmoved returns up to limit images whose content is still stored in the
+// database.
+func (m *ImageModel) Unmoved(ctx context.Context, limit int) ([]*Image, error) {
+	query := `
+		SELECT id, hash, content_type, image_data
+		FROM image
+		WHERE image_data IS NOT NULL
+		ORDER BY id
+		LIMIT $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var images []*Image
+	for rows.Next() {
+		image := &Image{}
+		err = rows.Scan(&image.ID, &image.Hash, &image.ContentType, &image.Data)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
+}
+
+// Moved drops the content of an image from the database once it is in blob
+// storage, recording the dimensions read from it.
+func (m *ImageModel) Moved(ctx context.Context, image *Image) error {
+	query := `
+		UPDATE image
+		SET image_data = NULL, width = $2, height = $3, byte_size = $4
+		WHERE id = $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, image.ID, image.Width, image.Height, image.Size)
+	return err
+}
+
+// UnmovedVariants returns up to limit variants whose content is still
+// stored in the database.
+func (m *ImageModel) UnmovedVariants(ctx context.Context, limit int) ([]*ImageVariant, error) {
+	query := `
+		SELECT v.image_id, i.hash, v.size, v.content_type, v.image_data
+		FROM image_variant v
+		JOIN image i ON i.id = v.image_id
+		WHERE v.image_data IS NOT NULL
+		ORDER BY v.image_id, v.size, v.content_type
+		LIMIT $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var variants []*ImageVariant
+	for rows.Next() {
+		v := &ImageVariant{}
+		err = rows.Scan(&v.ImageID, &v.Hash, &v.Size, &v.ContentType, &v.Data)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, v)
+	}
+
+	return variants, rows.Err()
+}
+
+// VariantMoved drops the content of a variant from the database once it is
+// in blob storage.
+func (m *ImageModel) VariantMoved(ctx context.Context, v *ImageVariant) error {
+	query := `
+		UPDATE image_variant
+		SET image_data = NULL, byte_size = $4
+		WHERE image_id = $1 AND size = $2 AND content_type = $3`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, v.ImageID, v.Size, v.ContentType, len(v.Data))
+	return err
 }
@@ -1,7 +1,6 @@
 package data
 
 import (
-	"database/sql"
 	"errors"
 )
 
@@ -12,19 +11,25 @@ var (
 )
 
 type Models struct {
-	Users        UserModel
-	Publications PublicationModel
-	Articles     ArticleModel
-	Images       ImageModel
-	Comments     CommentModel
+	Users         UserModel
+	Publications  PublicationModel
+	Articles      ArticleModel
+	Images        ImageModel
+	Comments      CommentModel
+	Notifications NotificationModel
+	Bookmarks     BookmarkModel
+	ReadingLists  ReadingListModel
 }
 
-func NewModels(db *sql.DB) Models {
+func NewModels(db *DB) Models {
 	return Models{
-		Users:        UserModel{DB: db},
-		Publications: PublicationModel{DB: db},
-		Articles:     ArticleModel{DB: db},
-		Images:       ImageModel{DB: db},
-		Comments:     CommentModel{DB: db},
+		Users:         UserModel{DB: db},
+		Publications:  PublicationModel{DB: db},
+		Articles:      ArticleModel{DB: db},
+		Images:        ImageModel{DB: db},
+		Comments:      CommentModel{DB: db},
+		Notifications: NotificationModel{DB: db},
+		Bookmarks:     BookmarkModel{DB: db},
+		ReadingLists:  ReadingListModel{DB: db},
 	}
 }
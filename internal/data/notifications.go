@@ -0,0 +1,328 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+const (
+	NotificationComment            = "comment"
+	NotificationReply              = "reply"
+	NotificationArticleLike        = "article_like"
+	NotificationCommentLike        = "comment_like"
+	NotificationInvitation         = "invitation"
+	NotificationInvitationAccepted = "invitation_accepted"
+	NotificationNewArticle         = "new_article"
+)
+
+// NotificationTypes lists every notification type in the order they are
+// shown in the user settings.
+var NotificationTypes = []string{
+	NotificationComment,
+	NotificationReply,
+	NotificationArticleLike,
+	NotificationCommentLike,
+	NotificationInvitation,
+	NotificationInvitationAccepted,
+	NotificationNewArticle,
+}
+
+type Notification struct {
+	ID            int
+	CreatedAt     time.Time
+	UserID        int
+	ActorID       int
+	Type          string
+	PublicationID sql.NullInt64
+	ArticleID     sql.NullInt64
+	CommentID     sql.NullInt64
+	Read          bool
+
+	// relations
+	Actor       *User
+	Publication *Publication
+	Article     *Article
+}
+
+func (n *Notification) URL() string {
+	switch n.Type {
+	case NotificationInvitation:
+		return "/user/invitations"
+	case NotificationInvitationAccepted:
+		return n.Publication.GetAboutURL()
+	case NotificationComment, NotificationReply, NotificationCommentLike:
+		return n.Publication.GetArticleURL(n.Article) + "#comments"
+	default:
+		return n.Publication.GetArticleURL(n.Article)
+	}
+}
+
+type NotificationModel struct {
+	DB *DB
+}
+
+// notify inserts a notification of the given type for every user returned by
+// the recipients subquery. Recipients subquery parameters start from $6. The
+// actor never gets notified of their own actions and recipients who have
+// disabled the type are skipped.
+func (m *NotificationModel) notify(ctx context.Context, recipients string, actorID int, kind string, publicationID, articleID, commentID sql.NullInt64, args ...interface{}) error {
+	query := fmt.Sprintf(`
+		INSERT INTO notification (user_id, actor_id, type, publication_id, article_id, comment_id)
+		SELECT DISTINCT r.user_id, $1, $2, $3::int, $4::int, $5::int
+		FROM (%s) r(user_id)
+		WHERE r.user_id <> $1 AND NOT EXISTS (
+			SELECT 1
+			FROM notification_preference np
+			WHERE np.user_id = r.user_id AND np.type = $2 AND NOT np.enabled
+		)`, recipients)
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	args = append([]interface{}{actorID, kind, publicationID, articleID, commentID}, args...)
+
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: true}
+}
+
+// CommentCreated notifies the writer of the article and everyone else who has
+// commented on it.
+func (m *NotificationModel) CommentCreated(ctx context.Context, article *Article, commenter *User) error {
+	err := m.notify(ctx, `SELECT $6::int`, commenter.ID, NotificationComment,
+		nullID(article.PublicationID), nullID(article.ID), sql.NullInt64{}, article.WriterID)
+	if err != nil {
+		return err
+	}
+
+	return m.notify(ctx, `SELECT commenter_id FROM comment WHERE article_id = $6 AND commenter_id <> $7`, commenter.ID, NotificationReply,
+		nullID(article.PublicationID), nullID(article.ID), sql.NullInt64{}, article.ID, article.WriterID)
+}
+
+func (m *NotificationModel) ArticleLiked(ctx context.Context, article *Article, user *User) error {
+	return m.notify(ctx, `SELECT $6::int`, user.ID, NotificationArticleLike,
+		nullID(article.PublicationID), nullID(article.ID), sql.NullInt64{}, article.WriterID)
+}
+
+func (m *NotificationModel) CommentLiked(ctx context.Context, article *Article, comment *Comment, user *User) error {
+	return m.notify(ctx, `SELECT $6::int`, user.ID, NotificationCommentLike,
+		nullID(article.PublicationID), nullID(article.ID), nullID(comment.ID), comment.CommenterID)
+}
+
+func (m *NotificationModel) Invited(ctx context.Context, publication *Publication, invited, inviter *User) error {
+	return m.notify(ctx, `SELECT $6::int`, inviter.ID, NotificationInvitation,
+		nullID(publication.ID), sql.NullInt64{}, sql.NullInt64{}, invited.ID)
+}
+
+// InvitationAccepted notifies the owner of the publication.
+func (m *NotificationModel) InvitationAccepted(ctx context.Context, publicationID int, user *User) error {
+	return m.notify(ctx, `SELECT owner_id FROM publication WHERE id = $6`, user.ID, NotificationInvitationAccepted,
+		nullID(publicationID), sql.NullInt64{}, sql.NullInt64{}, publicationID)
+}
+
+// ArticlePublished notifies every subscriber of the publication.
+func (m *NotificationModel) ArticlePublished(ctx context.Context, article *Article, writer *User) error {
+	return m.notify(ctx, `SELECT user_id FROM subscribes_to WHERE publication_id = $6`, writer.ID, NotificationNewArticle,
+		nullID(article.PublicationID), nullID(article.ID), sql.NullInt64{}, article.PublicationID)
+}
+
+func (m *NotificationModel) ForUser(ctx context.Context, user *User, filters Filters) ([]*Notification, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), n.id, n.created_at, n.user_id, n.actor_id, n.type, n.publication_id, n.article_id, n.comment_id, n.read_at IS NOT NULL,
+		       u.name, u.image_id, coalesce(p.name, ''), coalesce(p.url, ''), coalesce(a.title, '')
+		FROM notification n
+		JOIN users u on u.id = n.actor_id
+		LEFT JOIN publication p on p.id = n.publication_id
+		LEFT JOIN article a on a.id = n.article_id
+		WHERE n.user_id = $1
+		ORDER BY n.id DESC
+		LIMIT $2 OFFSET $3`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+	defer rows.Close()
+
+	totalRecords := 0
+	var notifications []*Notification
+
+	for rows.Next() {
+		n := &Notification{
+			Actor:       &User{},
+			Publication: &Publication{},
+			Article:     &Article{},
+		}
+		err = rows.Scan(&totalRecords, &n.ID, &n.CreatedAt, &n.UserID, &n.ActorID, &n.Type, &n.PublicationID, &n.ArticleID, &n.CommentID, &n.Read,
+			&n.Actor.Name, &n.Actor.ImageID, &n.Publication.Name, &n.Publication.URL, &n.Article.Title)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		n.Actor.ID = n.ActorID
+		n.Publication.ID = int(n.PublicationID.Int64)
+		n.Article.ID = int(n.ArticleID.Int64)
+		n.Article.SetURL()
+
+		notifications = append(notifications, n)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metaData := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return notifications, metaData, nil
+}
+
+func (m *NotificationModel) UnreadCount(ctx context.Context, user *User) (int, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM notification
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, user.ID).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// MarkRead marks the notification read and returns it so the caller can
+// redirect to whatever it points at.
+func (m *NotificationModel) MarkRead(ctx context.Context, user *User, notificationID int) (*Notification, error) {
+	query := `
+		WITH n AS (
+			UPDATE notification
+			SET read_at = coalesce(read_at, now())
+			WHERE id = $1 AND user_id = $2
+			RETURNING type, publication_id, article_id
+		)
+		SELECT n.type, n.publication_id, n.article_id, coalesce(p.url, ''), coalesce(a.title, '')
+		FROM n
+		LEFT JOIN publication p on p.id = n.publication_id
+		LEFT JOIN article a on a.id = n.article_id`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	n := &Notification{
+		ID:          notificationID,
+		UserID:      user.ID,
+		Read:        true,
+		Publication: &Publication{},
+		Article:     &Article{},
+	}
+
+	row := m.DB.QueryRowContext(ctx, query, notificationID, user.ID)
+	err := row.Scan(&n.Type, &n.PublicationID, &n.ArticleID, &n.Publication.URL, &n.Article.Title)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	n.Publication.ID = int(n.PublicationID.Int64)
+	n.Article.ID = int(n.ArticleID.Int64)
+	n.Article.SetURL()
+
+	return n, nil
+}
+
+func (m *NotificationModel) MarkAllRead(ctx context.Context, user *User) error {
+	query := `
+		UPDATE notification
+		SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Preferences returns whether each notification type is enabled for the user.
+// Types without a stored preference are enabled.
+func (m *NotificationModel) Preferences(ctx context.Context, user *User) (map[string]bool, error) {
+	query := `
+		SELECT type, enabled
+		FROM notification_preference
+		WHERE user_id = $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	prefs := make(map[string]bool, len(NotificationTypes))
+	for _, kind := range NotificationTypes {
+		prefs[kind] = true
+	}
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var kind string
+		var enabled bool
+		err = rows.Scan(&kind, &enabled)
+		if err != nil {
+			return nil, err
+		}
+		prefs[kind] = enabled
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return prefs, nil
+}
+
+func (m *NotificationModel) SetPreferences(ctx context.Context, user *User, prefs map[string]bool) error {
+	query := `
+		INSERT INTO notification_preference (user_id, type, enabled)
+		VALUES ($1, $2, $3)
+		ON CONFLICT ON CONSTRAINT notification_preference_pk
+		DO UPDATE SET enabled = EXCLUDED.enabled`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for kind, enabled := range prefs {
+		_, err = tx.ExecContext(ctx, query, user.ID, kind, enabled)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
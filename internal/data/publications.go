@@ -5,17 +5,22 @@ import (
 	"database/sql"
 	"fmt"
 	"github.com/gosimple/slug"
+	"github.com/lib/pq"
 	"time"
 )
 
 type Publication struct {
-	ID          int
-	Name        string
-	URL         string
-	Description string
-	OwnerID     int
-	CreatedAt   time.Time
-	Version     int
+	ID               int
+	Name             string
+	URL              string
+	Description      string
+	OwnerID          int
+	CodeStyle        string
+	MarkdownFeatures []string
+	AllowTables      bool
+	FrameHosts       []string
+	CreatedAt        time.Time
+	Version          int
 
 	// relations
 	Subscribers int
@@ -33,6 +38,15 @@ func (p *Publication) GetAboutURL() string {
 	return fmt.Sprintf("/%s/about", p.URL)
 }
 
+// GetArchiveURL returns the URL of the articles published in the year, or in
+// the month of it unless month is zero.
+func (p *Publication) GetArchiveURL(year, month int) string {
+	if month == 0 {
+		return fmt.Sprintf("/%s/archive/%d", p.URL, year)
+	}
+	return fmt.Sprintf("/%s/archive/%d/%d", p.URL, year, month)
+}
+
 func (p *Publication) GetArticleURL(article *Article) string {
 	return fmt.Sprintf("/%s/%s", p.URL, article.URL)
 }
@@ -43,22 +57,24 @@ type Profile struct {
 }
 
 type PublicationModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (m *PublicationModel) GetBySlug(slug string) (*Publication, error) {
+func (m *PublicationModel) GetBySlug(ctx context.Context, slug string) (*Publication, error) {
 	query := `
-		SELECT id, name, url, description, owner_id, created_at, version
+		SELECT id, name, url, description, owner_id, code_style, markdown_features, allow_tables, frame_hosts,
+			created_at, version
 		FROM publication
 		WHERE url = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	row := m.DB.QueryRowContext(ctx, query, slug)
 
 	p := &Publication{}
-	err := row.Scan(&p.ID, &p.Name, &p.URL, &p.Description, &p.OwnerID, &p.CreatedAt, &p.Version)
+	err := row.Scan(&p.ID, &p.Name, &p.URL, &p.Description, &p.OwnerID, &p.CodeStyle, pq.Array(&p.MarkdownFeatures),
+		&p.AllowTables, pq.Array(&p.FrameHosts), &p.CreatedAt, &p.Version)
 	if err == sql.ErrNoRows {
 		return nil, ErrRecordNotFound
 	} else if err != nil {
@@ -68,7 +84,7 @@ func (m *PublicationModel) GetBySlug(slug string) (*Publication, error) {
 	return p, nil
 }
 
-func (m *PublicationModel) GetUsersPublications(userID int) (*Profile, error) {
+func (m *PublicationModel) GetUsersPublications(ctx context.Context, userID int) (*Profile, error) {
 	ps := &Profile{}
 
 	qt := []struct {
@@ -111,7 +127,7 @@ func (m *PublicationModel) GetUsersPublications(userID int) (*Profile, error) {
 		},
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	for _, q := range qt {
@@ -138,13 +154,13 @@ func (m *PublicationModel) GetUsersPublications(userID int) (*Profile, error) {
 	return ps, nil
 }
 
-func (m *PublicationModel) Delete(publication *Publication) error {
+func (m *PublicationModel) Delete(ctx context.Context, publication *Publication) error {
 	query := `
 		DELETE
 		FROM publication p
 		WHERE p.id = $1;`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, publication.ID)
@@ -156,14 +172,14 @@ func (m *PublicationModel) Delete(publication *Publication) error {
 	return nil
 }
 
-func (m *PublicationModel) Insert(userID int, name, description string) (string, error) {
+func (m *PublicationModel) Insert(ctx context.Context, userID int, name, description string) (string, error) {
 	query := `
 		INSERT INTO publication (name, url, description, owner_id)
 		VALUES ($1, $2, $3, $4)`
 
 	url := slug.Make(name)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, name, url, description, userID)
@@ -179,7 +195,78 @@ func (m *PublicationModel) Insert(userID int, name, description string) (string,
 	return url, nil
 }
 
-func (m *PublicationModel) UserIsWriter(publication *Publication, user *User) (bool, error) {
+// ChangeCodeStyle sets the style code blocks in the articles of the
+// publication are highlighted in.
+func (m *PublicationModel) ChangeCodeStyle(ctx context.Context, publication *Publication, style string) error {
+	query := `
+		UPDATE publication
+		SET code_style = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, style, publication.ID, publication.Version).Scan(&publication.Version)
+	if err == sql.ErrNoRows {
+		return ErrEditConflict
+	} else if err != nil {
+		return err
+	}
+
+	publication.CodeStyle = style
+	return nil
+}
+
+// ChangeMarkdownFeatures sets the extensions of Markdown enabled for the
+// articles of the publication.
+func (m *PublicationModel) ChangeMarkdownFeatures(ctx context.Context, publication *Publication, features []string) error {
+	query := `
+		UPDATE publication
+		SET markdown_features = $1, version = version + 1
+		WHERE id = $2 AND version = $3
+		RETURNING version`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, pq.Array(features), publication.ID, publication.Version).Scan(&publication.Version)
+	if err == sql.ErrNoRows {
+		return ErrEditConflict
+	} else if err != nil {
+		return err
+	}
+
+	publication.MarkdownFeatures = features
+	return nil
+}
+
+// ChangeHTMLPolicy sets what HTML the articles of the publication may hold
+// beyond the Markdown: tables, and iframes of pages on the hosts.
+func (m *PublicationModel) ChangeHTMLPolicy(ctx context.Context, publication *Publication, tables bool, frameHosts []string) error {
+	query := `
+		UPDATE publication
+		SET allow_tables = $1, frame_hosts = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, tables, pq.Array(frameHosts), publication.ID, publication.Version).
+		Scan(&publication.Version)
+	if err == sql.ErrNoRows {
+		return ErrEditConflict
+	} else if err != nil {
+		return err
+	}
+
+	publication.AllowTables = tables
+	publication.FrameHosts = frameHosts
+	return nil
+}
+
+func (m *PublicationModel) UserIsWriter(ctx context.Context, publication *Publication, user *User) (bool, error) {
 	if user == nil || publication == nil {
 		return false, nil
 	}
@@ -190,7 +277,7 @@ func (m *PublicationModel) UserIsWriter(publication *Publication, user *User) (b
 		WHERE wo.user_id = $1 AND wo.publication_id = $2
 		LIMIT 1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var exists int
@@ -204,7 +291,7 @@ func (m *PublicationModel) UserIsWriter(publication *Publication, user *User) (b
 	return exists == 1, nil
 }
 
-func (m *PublicationModel) UserIsSubscribed(publication *Publication, user *User) (bool, error) {
+func (m *PublicationModel) UserIsSubscribed(ctx context.Context, publication *Publication, user *User) (bool, error) {
 	if user == nil || publication == nil {
 		return false, nil
 	}
@@ -215,7 +302,7 @@ func (m *PublicationModel) UserIsSubscribed(publication *Publication, user *User
 		WHERE st.user_id = $1 AND st.publication_id = $2
 		LIMIT 1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var exists int
@@ -229,12 +316,12 @@ func (m *PublicationModel) UserIsSubscribed(publication *Publication, user *User
 	return exists == 1, nil
 }
 
-func (m *PublicationModel) Invite(publication *Publication, user *User) error {
+func (m *PublicationModel) Invite(ctx context.Context, publication *Publication, user *User) error {
 	query := `
 		INSERT INTO invitation (user_id, publication_id)
 		VALUES ($1, $2)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, user.ID, publication.ID)
@@ -248,12 +335,12 @@ func (m *PublicationModel) Invite(publication *Publication, user *User) error {
 	return nil
 }
 
-func (m *PublicationModel) Withdraw(publication *Publication, userID int) error {
+func (m *PublicationModel) Withdraw(ctx context.Context, publication *Publication, userID int) error {
 	query := `
 		DELETE FROM invitation
 		WHERE user_id = $1 AND publication_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, publication.ID)
@@ -266,7 +353,7 @@ func (m *PublicationModel) Withdraw(publication *Publication, userID int) error
 	return nil
 }
 
-func (m *PublicationModel) Invitations(publication *Publication) ([]*User, error) {
+func (m *PublicationModel) Invitations(ctx context.Context, publication *Publication) ([]*User, error) {
 
 	stmt := `
 		SELECT id, name, email, created_at, image_id
@@ -274,7 +361,7 @@ func (m *PublicationModel) Invitations(publication *Publication) ([]*User, error
 		JOIN users on id = invitation.user_id
 		WHERE publication_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var users []*User
@@ -297,12 +384,12 @@ func (m *PublicationModel) Invitations(publication *Publication) ([]*User, error
 	return users, nil
 }
 
-func (m *PublicationModel) Kick(publication *Publication, userID int) error {
+func (m *PublicationModel) Kick(ctx context.Context, publication *Publication, userID int) error {
 	query := `
 		DELETE FROM writes_on
 		WHERE user_id = $1 AND publication_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, query, userID, publication.ID)
@@ -315,57 +402,66 @@ func (m *PublicationModel) Kick(publication *Publication, userID int) error {
 	return nil
 }
 
-func (m *PublicationModel) ArticlePublications(articles []*Article) (map[int]*Publication, error) {
+// GetMany returns the publications with the ids, keyed by id. Ids of
+// publications that don't exist are left out.
+func (m *PublicationModel) GetMany(ctx context.Context, ids []int) (map[int]*Publication, error) {
+	pubs := make(map[int]*Publication, len(ids))
+	if len(ids) == 0 {
+		return pubs, nil
+	}
+
 	query := `
 		SELECT id, name, url, description, owner_id, created_at, version
 		FROM publication
-		WHERE id = $1`
-
-	pubs := make(map[int]*Publication)
+		WHERE id = ANY($1)`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 6*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	for _, article := range articles {
-		if _, ok := pubs[article.PublicationID]; ok {
-			continue
-		}
-		row := m.DB.QueryRowContext(ctx, query, article.PublicationID)
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
+	for rows.Next() {
 		p := &Publication{}
-		err := row.Scan(&p.ID, &p.Name, &p.URL, &p.Description, &p.OwnerID, &p.CreatedAt, &p.Version)
-
-		if err == sql.ErrNoRows {
-			return nil, ErrRecordNotFound
-		} else if err != nil {
+		err = rows.Scan(&p.ID, &p.Name, &p.URL, &p.Description, &p.OwnerID, &p.CreatedAt, &p.Version)
+		if err != nil {
 			return nil, err
 		}
-
 		pubs[p.ID] = p
 	}
 
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return pubs, nil
 }
 
-func (m *PublicationModel) Publications(filters Filters) ([]*Publication, Metadata, error) {
-	query := `
-		SELECT count(*) OVER(), p.id, p.name, p.url, p.description, p.owner_id, p.created_at, p.version, count(st.user_id) as subscribers
-		FROM subscribes_to st
-		RIGHT JOIN publication p on p.id = st.publication_id
-		GROUP BY p.id
-		ORDER BY subscribers DESC, p.id DESC
-		LIMIT $1 OFFSET $2`
+func (m *PublicationModel) Publications(ctx context.Context, filters Filters) ([]*Publication, Metadata, error) {
+	query := fmt.Sprintf(`
+		SELECT %s, p.id, p.name, p.url, p.description, p.owner_id, p.created_at, p.version, p.subscribers
+		FROM publication p
+		WHERE %s
+		ORDER BY %s
+		LIMIT $1 OFFSET $2`, filters.totalRecords(), filters.keyset("p", 3), filters.orderBy("p"))
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	args := append([]any{filters.limit(), filters.offset()}, filters.keysetArgs()...)
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
+	defer rows.Close()
 
 	totalRecords := 0
 	pubs := make([]*Publication, 0, filters.PageSize)
+	var cursors []Cursor
 	for rows.Next() {
 		p := &Publication{}
 		err = rows.Scan(&totalRecords, &p.ID, &p.Name, &p.URL, &p.Description, &p.OwnerID, &p.CreatedAt, &p.Version, &p.Subscribers)
@@ -374,12 +470,21 @@ func (m *PublicationModel) Publications(filters Filters) ([]*Publication, Metada
 		}
 
 		pubs = append(pubs, p)
+		if filters.Keyset {
+			keys := map[string]any{"created_at": p.CreatedAt, "subscribers": p.Subscribers}
+			cursors = append(cursors, filters.cursorAt(keys[filters.sortColumn()], p.ID))
+		}
 	}
 
 	if err = rows.Err(); err != nil {
 		return nil, Metadata{}, err
 	}
 
+	if filters.Keyset {
+		pubs, metaData := keysetPage(filters, pubs, cursors)
+		return pubs, metaData, nil
+	}
+
 	metaData := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
 
 	return pubs, metaData, nil
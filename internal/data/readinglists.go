@@ -0,0 +1,207 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type ReadingList struct {
+	ID        int
+	UserID    int
+	Name      string
+	Public    bool
+	CreatedAt time.Time
+	Version   int
+
+	// relations
+	Articles int
+}
+
+type ReadingListModel struct {
+	DB *DB
+}
+
+func (m *ReadingListModel) Insert(ctx context.Context, user *User, name string, public bool) (*ReadingList, error) {
+	query := `
+		INSERT INTO reading_list (user_id, name, public)
+		VALUES ($1, $2, $3)
+		RETURNING id, user_id, name, public, created_at, version`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	l := &ReadingList{}
+	row := m.DB.QueryRowContext(ctx, query, user.ID, name, public)
+	err := row.Scan(&l.ID, &l.UserID, &l.Name, &l.Public, &l.CreatedAt, &l.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (m *ReadingListModel) Get(ctx context.Context, id int) (*ReadingList, error) {
+	query := `
+		SELECT l.id, l.user_id, l.name, l.public, l.created_at, l.version, count(rla.article_id)
+		FROM reading_list l
+		LEFT JOIN reading_list_article rla on l.id = rla.reading_list_id
+		WHERE l.id = $1
+		GROUP BY l.id`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	l := &ReadingList{}
+	row := m.DB.QueryRowContext(ctx, query, id)
+	err := row.Scan(&l.ID, &l.UserID, &l.Name, &l.Public, &l.CreatedAt, &l.Version, &l.Articles)
+	if err == sql.ErrNoRows {
+		return nil, ErrRecordNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// ForUser returns the reading lists of the user. Private lists are left out
+// unless includePrivate is set.
+func (m *ReadingListModel) ForUser(ctx context.Context, user *User, includePrivate bool) ([]*ReadingList, error) {
+	query := `
+		SELECT l.id, l.user_id, l.name, l.public, l.created_at, l.version, count(rla.article_id)
+		FROM reading_list l
+		LEFT JOIN reading_list_article rla on l.id = rla.reading_list_id
+		WHERE l.user_id = $1 AND (l.public OR $2)
+		GROUP BY l.id
+		ORDER BY l.name, l.id`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, user.ID, includePrivate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []*ReadingList
+	for rows.Next() {
+		l := &ReadingList{}
+		err = rows.Scan(&l.ID, &l.UserID, &l.Name, &l.Public, &l.CreatedAt, &l.Version, &l.Articles)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, l)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return lists, nil
+}
+
+func (m *ReadingListModel) Update(ctx context.Context, list *ReadingList) error {
+	query := `
+		UPDATE reading_list
+		SET name = $1, public = $2, version = version + 1
+		WHERE id = $3 AND version = $4
+		RETURNING version`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	err := m.DB.QueryRowContext(ctx, query, list.Name, list.Public, list.ID, list.Version).Scan(&list.Version)
+	if err == sql.ErrNoRows {
+		return ErrEditConflict
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *ReadingListModel) Delete(ctx context.Context, list *ReadingList) error {
+	query := `
+		DELETE FROM reading_list
+		WHERE id = $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, list.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *ReadingListModel) AddArticle(ctx context.Context, list *ReadingList, article *Article) error {
+	query := `
+		INSERT INTO reading_list_article (reading_list_id, article_id)
+		VALUES ($1, $2)
+		ON CONFLICT ON CONSTRAINT reading_list_article_pk DO NOTHING`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, list.ID, article.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *ReadingListModel) RemoveArticle(ctx context.Context, list *ReadingList, articleID int) error {
+	query := `
+		DELETE FROM reading_list_article
+		WHERE reading_list_id = $1 AND article_id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, list.ID, articleID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *ReadingListModel) GetArticles(ctx context.Context, list *ReadingList) ([]*Article, error) {
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM reading_list_article rla
+		JOIN article a on a.id = rla.article_id
+		WHERE rla.reading_list_id = $1
+		ORDER BY rla.created_at DESC, a.id DESC`, summaryColumns("a"))
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, list.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var articles []*Article
+	for rows.Next() {
+		a := &Article{}
+		err = rows.Scan(a.summaryFields()...)
+		if err != nil {
+			return nil, err
+		}
+		a.setSummary()
+		articles = append(articles, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return articles, nil
+}
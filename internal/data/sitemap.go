@@ -0,0 +1,91 @@
+package data
+
+import (
+	"context"
+	"time"
+)
+
+// maxSitemapURLs is the most URLs a sitemap may list.
+const maxSitemapURLs = 50_000
+
+// SitemapEntry is a page of the site for the sitemaps, with when it last
+// changed.
+type SitemapEntry struct {
+	Path    string
+	LastMod time.Time
+}
+
+// Sitemap returns the home pages of the publications, changed when their
+// latest article was published.
+func (m *PublicationModel) Sitemap(ctx context.Context) ([]SitemapEntry, error) {
+	query := `
+		SELECT p.url, greatest(p.created_at, max(a.created_at))
+		FROM publication p
+		LEFT JOIN article a ON a.publication_id = p.id
+		GROUP BY p.id
+		ORDER BY p.id
+		LIMIT $1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, maxSitemapURLs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []SitemapEntry
+	for rows.Next() {
+		p := &Publication{}
+		var lastMod time.Time
+		err = rows.Scan(&p.URL, &lastMod)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, SitemapEntry{Path: p.GetBaseURL(), LastMod: lastMod})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// Sitemap returns the articles of the publication, latest first.
+func (m *ArticleModel) Sitemap(ctx context.Context, publication *Publication) ([]SitemapEntry, error) {
+	query := `
+		SELECT id, title, created_at
+		FROM article
+		WHERE publication_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	// leave room for the pages of the publication itself
+	rows, err := m.DB.QueryContext(ctx, query, publication.ID, maxSitemapURLs-2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []SitemapEntry
+	for rows.Next() {
+		a := &Article{}
+		err = rows.Scan(&a.ID, &a.Title, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		a.SetURL()
+		entries = append(entries, SitemapEntry{Path: publication.GetArticleURL(a), LastMod: a.CreatedAt})
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
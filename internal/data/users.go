@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"errors"
 	"github.com/gosimple/slug"
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
@@ -28,10 +29,10 @@ func (u *User) Matches(url string) bool {
 }
 
 type UserModel struct {
-	DB *sql.DB
+	DB *DB
 }
 
-func (m *UserModel) Insert(name, email, password string) (int, error) {
+func (m *UserModel) Insert(ctx context.Context, name, email, password string) (int, error) {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), 12)
 	if err != nil {
 		return 0, err
@@ -42,7 +43,7 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 		VALUES ($1, $2, $3)
 		RETURNING id`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	id := 0
@@ -59,11 +60,11 @@ func (m *UserModel) Insert(name, email, password string) (int, error) {
 	return id, nil
 }
 
-func (m *UserModel) Authenticate(email, password string) (int, error) {
+func (m *UserModel) Authenticate(ctx context.Context, email, password string) (int, error) {
 	var id int
 	var hashedPassword []byte
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 	row := m.DB.QueryRowContext(ctx, `SELECT id, password_hash FROM users WHERE email = $1`, email)
 	err := row.Scan(&id, &hashedPassword)
@@ -83,12 +84,12 @@ func (m *UserModel) Authenticate(email, password string) (int, error) {
 	return id, nil
 }
 
-func (m *UserModel) Get(id int) (*User, error) {
+func (m *UserModel) Get(ctx context.Context, id int) (*User, error) {
 	s := &User{}
 
 	stmt := `SELECT id, name, email, created_at, image_id, version FROM users WHERE id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, stmt, id).Scan(&s.ID, &s.Name, &s.Email, &s.CreatedAt, &s.ImageID, &s.Version)
@@ -102,7 +103,7 @@ func (m *UserModel) Get(id int) (*User, error) {
 	return s, nil
 }
 
-func (m *UserModel) GetWritersOfPublication(publication *Publication) ([]*User, error) {
+func (m *UserModel) GetWritersOfPublication(ctx context.Context, publication *Publication) ([]*User, error) {
 
 	stmt := `
 		SELECT id, name, email, created_at, image_id
@@ -110,7 +111,7 @@ func (m *UserModel) GetWritersOfPublication(publication *Publication) ([]*User,
 		JOIN users on id = writes_on.user_id
 		WHERE publication_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var users []*User
@@ -133,63 +134,172 @@ func (m *UserModel) GetWritersOfPublication(publication *Publication) ([]*User,
 	return users, nil
 }
 
-func (m *UserModel) ChangeProfilePicture(user *User, id int) error {
-	query := `
-		UPDATE users
-		SET image_id = $1, version = version + 1
-		WHERE id = $2 AND version = $3`
+// avatarHistory is the number of pictures kept for a user to go back to,
+// including the current one.
+const avatarHistory = 5
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+// ChangeProfilePicture makes the image the picture of the user and adds it
+// to the pictures the user can go back to, forgetting the oldest ones.
+func (m *UserModel) ChangeProfilePicture(ctx context.Context, user *User, id int) error {
+	query := `
+		WITH updated AS (
+			UPDATE users
+			SET image_id = $1, version = version + 1
+			WHERE id = $2 AND version = $3
+			RETURNING id
+		), remembered AS (
+			INSERT INTO user_avatar (user_id, image_id)
+			SELECT id, $1 FROM updated
+			ON CONFLICT ON CONSTRAINT user_avatar_pk DO UPDATE SET created_at = now()
+		), forgotten AS (
+			DELETE
+			FROM user_avatar
+			WHERE user_id = $2
+			  AND image_id <> $1
+			  AND EXISTS (SELECT 1 FROM updated)
+			  AND image_id NOT IN (SELECT image_id
+			                       FROM user_avatar
+			                       WHERE user_id = $2 AND image_id <> $1
+			                       ORDER BY created_at DESC
+			                       LIMIT $4)
+		)
+		SELECT id FROM updated`
+
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, id, user.ID, user.Version)
-	if err != nil {
+	var updated int
+	err := m.DB.QueryRowContext(ctx, query, id, user.ID, user.Version, avatarHistory-1).Scan(&updated)
+	if err == sql.ErrNoRows {
+		return ErrEditConflict
+	} else if err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (m *UserModel) SubscribeTo(user *User, publication *Publication) error {
+// Avatars returns the pictures the user had, the latest first.
+func (m *UserModel) Avatars(ctx context.Context, user *User) ([]*Image, error) {
 	query := `
-		INSERT INTO subscribes_to (user_id, publication_id)
-		VALUES ($1, $2)`
+		SELECT i.id, i.hash, i.content_type, i.width, i.height, i.byte_size, i.owner_id
+		FROM user_avatar ua
+		JOIN image i ON i.id = ua.image_id
+		WHERE ua.user_id = $1
+		ORDER BY ua.created_at DESC, i.id DESC`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user.ID, publication.ID)
+	rows, err := m.DB.QueryContext(ctx, query, user.ID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	return nil
+	var images []*Image
+	for rows.Next() {
+		image := &Image{}
+		err = rows.Scan(&image.ID, &image.Hash, &image.ContentType, &image.Width, &image.Height, &image.Size,
+			&image.OwnerID)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, image)
+	}
+
+	return images, rows.Err()
 }
 
-func (m *UserModel) UnsubscribeFrom(user *User, publication *Publication) error {
+// RestoreProfilePicture makes a picture the user had before the current one
+// again.
+func (m *UserModel) RestoreProfilePicture(ctx context.Context, user *User, id int) error {
 	query := `
-		DELETE FROM subscribes_to
-		WHERE user_id = $1 AND publication_id = $2`
+		WITH avatar AS (
+			UPDATE user_avatar
+			SET created_at = now()
+			WHERE user_id = $2 AND image_id = $1
+			RETURNING image_id
+		)
+		UPDATE users
+		SET image_id = avatar.image_id, version = version + 1
+		FROM avatar
+		WHERE users.id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user.ID, publication.ID)
-	if err == sql.ErrNoRows {
-		return ErrRecordNotFound
-	} else if err != nil {
+	result, err := m.DB.ExecContext(ctx, query, id, user.ID)
+	if err != nil {
 		return err
 	}
 
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrRecordNotFound
+	}
+
 	return nil
 }
 
-func (m *UserModel) GetByEmail(email string) (*User, error) {
+// SubscribeTo subscribes the user to the publication, doing nothing if the
+// user already is subscribed. It returns the subscriber count of the
+// publication afterwards.
+func (m *UserModel) SubscribeTo(ctx context.Context, user *User, publication *Publication) (int, error) {
+	query := `
+		WITH inserted AS (
+			INSERT INTO subscribes_to (user_id, publication_id)
+			VALUES ($1, $2)
+			ON CONFLICT ON CONSTRAINT subscribes_to_pk DO NOTHING
+			RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM subscribes_to WHERE publication_id = $2) + (SELECT count(*) FROM inserted)`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var subscribers int
+	err := m.DB.QueryRowContext(ctx, query, user.ID, publication.ID).Scan(&subscribers)
+	if err != nil {
+		return 0, err
+	}
+
+	return subscribers, nil
+}
+
+// UnsubscribeFrom unsubscribes the user from the publication, doing nothing
+// if the user isn't subscribed. It returns the subscriber count of the
+// publication afterwards.
+func (m *UserModel) UnsubscribeFrom(ctx context.Context, user *User, publication *Publication) (int, error) {
+	query := `
+		WITH deleted AS (
+			DELETE FROM subscribes_to
+			WHERE user_id = $1 AND publication_id = $2
+			RETURNING 1
+		)
+		SELECT (SELECT count(*) FROM subscribes_to WHERE publication_id = $2) - (SELECT count(*) FROM deleted)`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var subscribers int
+	err := m.DB.QueryRowContext(ctx, query, user.ID, publication.ID).Scan(&subscribers)
+	if err != nil {
+		return 0, err
+	}
+
+	return subscribers, nil
+}
+
+func (m *UserModel) GetByEmail(ctx context.Context, email string) (*User, error) {
 	s := &User{}
 
 	stmt := `SELECT id, name, email, created_at, image_id FROM users WHERE email = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, stmt, email).Scan(&s.ID, &s.Name, &s.Email, &s.CreatedAt, &s.ImageID)
@@ -203,7 +313,7 @@ func (m *UserModel) GetByEmail(email string) (*User, error) {
 	return s, nil
 }
 
-func (m *UserModel) Invitations(user *User) ([]*Publication, error) {
+func (m *UserModel) Invitations(ctx context.Context, user *User) ([]*Publication, error) {
 
 	stmt := `
 		SELECT id, name, url, description, owner_id, created_at
@@ -211,7 +321,7 @@ func (m *UserModel) Invitations(user *User) ([]*Publication, error) {
 		JOIN publication on id = invitation.publication_id
 		WHERE user_id = $1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	var publications []*Publication
@@ -234,13 +344,13 @@ func (m *UserModel) Invitations(user *User) ([]*Publication, error) {
 	return publications, nil
 }
 
-func (m *UserModel) AcceptInvitation(user *User, publicationID int) error {
+func (m *UserModel) AcceptInvitation(ctx context.Context, user *User, publicationID int) error {
 	stmt := `
 		DELETE 
 		FROM invitation
 		WHERE user_id = $1 AND publication_id = $2`
 
-	ctx0, cancel0 := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx0, cancel0 := m.DB.timeout(ctx)
 	defer cancel0()
 
 	_, err := m.DB.ExecContext(ctx0, stmt, user.ID, publicationID)
@@ -255,7 +365,7 @@ func (m *UserModel) AcceptInvitation(user *User, publicationID int) error {
 		INSERT INTO writes_on (user_id, publication_id)
 		VALUES ($1, $2)`
 
-	ctx1, cancel1 := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx1, cancel1 := m.DB.timeout(ctx)
 	defer cancel1()
 
 	_, err = m.DB.ExecContext(ctx1, stmt, user.ID, publicationID)
@@ -270,13 +380,13 @@ func (m *UserModel) AcceptInvitation(user *User, publicationID int) error {
 	return nil
 }
 
-func (m *UserModel) DeclineInvitation(user *User, publicationID int) error {
+func (m *UserModel) DeclineInvitation(ctx context.Context, user *User, publicationID int) error {
 	stmt := `
 		DELETE 
 		FROM invitation
 		WHERE user_id = $1 AND publication_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, stmt, user.ID, publicationID)
@@ -290,13 +400,13 @@ func (m *UserModel) DeclineInvitation(user *User, publicationID int) error {
 	return nil
 }
 
-func (m *UserModel) Leave(user *User, publicationID int) error {
+func (m *UserModel) Leave(ctx context.Context, user *User, publicationID int) error {
 	stmt := `
 		DELETE 
 		FROM writes_on
 		WHERE user_id = $1 AND publication_id = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	_, err := m.DB.ExecContext(ctx, stmt, user.ID, publicationID)
@@ -310,136 +420,182 @@ func (m *UserModel) Leave(user *User, publicationID int) error {
 	return nil
 }
 
-func (m *UserModel) ArticleWriters(articles []*Article) (map[int]*User, error) {
-	writers := make(map[int]*User)
+// GetMany returns the users with the ids, keyed by id. Ids of users that
+// don't exist are left out.
+func (m *UserModel) GetMany(ctx context.Context, ids []int) (map[int]*User, error) {
+	users := make(map[int]*User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
 
-	for i := range articles {
-		id := articles[i].WriterID
-		if _, ok := writers[id]; ok {
-			continue
-		}
+	query := `
+		SELECT id, name, email, created_at, image_id, version
+		FROM users
+		WHERE id = ANY($1)`
 
-		writer, err := m.Get(id)
-		if err == sql.ErrNoRows {
-			return nil, ErrRecordNotFound
-		} else if err != nil {
-			return nil, err
-		}
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
 
-		writers[id] = writer
+	rows, err := m.DB.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
 	}
-	return writers, nil
-}
-
-func (m *UserModel) PublicationOwners(p []*Publication) (map[int]*User, error) {
-	owners := make(map[int]*User)
+	defer rows.Close()
 
-	for i := range p {
-		id := p[i].OwnerID
-		if _, ok := owners[id]; ok {
-			continue
-		}
-
-		owner, err := m.Get(id)
-		if err == sql.ErrNoRows {
-			return nil, ErrRecordNotFound
-		} else if err != nil {
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.ImageID, &u.Version)
+		if err != nil {
 			return nil, err
 		}
+		users[u.ID] = u
+	}
 
-		owners[id] = owner
+	if err = rows.Err(); err != nil {
+		return nil, err
 	}
-	return owners, nil
+
+	return users, nil
 }
 
-func (m *UserModel) LikeArticle(user *User, article *Article) error {
+// LikeArticle likes the article for the user, doing nothing if the user already
+// likes it. It returns the like afterwards and whether it is new.
+func (m *UserModel) LikeArticle(ctx context.Context, user *User, article *Article) (*Like, bool, error) {
 	query := `
-		INSERT INTO article_like (user_id, article_id)
-		VALUES ($1, $2)`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		WITH inserted AS (
+			INSERT INTO article_like (user_id, article_id)
+			VALUES ($1, $2)
+			ON CONFLICT ON CONSTRAINT article_like_pk DO NOTHING
+			RETURNING 1
+		)
+		SELECT likes + (SELECT count(*) FROM inserted), (SELECT count(*) FROM inserted) > 0
+		FROM article
+		WHERE id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user.ID, article.ID)
-	if err != nil {
-		return err
+	like := &Like{HasLiked: true}
+	var liked bool
+	err := m.DB.QueryRowContext(ctx, query, user.ID, article.ID).Scan(&like.Count, &liked)
+	if err == sql.ErrNoRows {
+		return nil, false, ErrRecordNotFound
+	} else if err != nil {
+		return nil, false, err
 	}
 
-	return nil
+	return like, liked, nil
 }
 
-func (m *UserModel) UnlikeArticle(user *User, article *Article) error {
+// UnlikeArticle removes the like of the user from the article, doing nothing if
+// the user doesn't like it. It returns the like afterwards.
+func (m *UserModel) UnlikeArticle(ctx context.Context, user *User, article *Article) (*Like, error) {
 	query := `
-		DELETE FROM article_like
-		WHERE user_id = $1 AND article_id = $2`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		WITH deleted AS (
+			DELETE FROM article_like
+			WHERE user_id = $1 AND article_id = $2
+			RETURNING 1
+		)
+		SELECT likes - (SELECT count(*) FROM deleted)
+		FROM article
+		WHERE id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user.ID, article.ID)
+	like := &Like{}
+	err := m.DB.QueryRowContext(ctx, query, user.ID, article.ID).Scan(&like.Count)
 	if err == sql.ErrNoRows {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	} else if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return like, nil
 }
 
-func (m *UserModel) LikeComment(user *User, comment *Comment) error {
+// LikeComment likes the comment for the user, doing nothing if the user already
+// likes it. It returns the like afterwards and whether it is new.
+func (m *UserModel) LikeComment(ctx context.Context, user *User, comment *Comment) (*Like, bool, error) {
 	query := `
-		INSERT INTO comment_like (user_id, comment_id)
-		VALUES ($1, $2)`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		WITH inserted AS (
+			INSERT INTO comment_like (user_id, comment_id)
+			VALUES ($1, $2)
+			ON CONFLICT ON CONSTRAINT comment_like_pk DO NOTHING
+			RETURNING 1
+		)
+		SELECT likes + (SELECT count(*) FROM inserted), (SELECT count(*) FROM inserted) > 0
+		FROM comment
+		WHERE id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user.ID, comment.ID)
-	if err != nil {
-		return err
+	like := &Like{HasLiked: true}
+	var liked bool
+	err := m.DB.QueryRowContext(ctx, query, user.ID, comment.ID).Scan(&like.Count, &liked)
+	if err == sql.ErrNoRows {
+		return nil, false, ErrRecordNotFound
+	} else if err != nil {
+		return nil, false, err
 	}
 
-	return nil
+	return like, liked, nil
 }
 
-func (m *UserModel) UnlikeComment(user *User, comment *Comment) error {
+// UnlikeComment removes the like of the user from the comment, doing nothing if
+// the user doesn't like it. It returns the like afterwards.
+func (m *UserModel) UnlikeComment(ctx context.Context, user *User, comment *Comment) (*Like, error) {
 	query := `
-		DELETE FROM comment_like
-		WHERE user_id = $1 AND comment_id = $2`
-
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		WITH deleted AS (
+			DELETE FROM comment_like
+			WHERE user_id = $1 AND comment_id = $2
+			RETURNING 1
+		)
+		SELECT likes - (SELECT count(*) FROM deleted)
+		FROM comment
+		WHERE id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, user.ID, comment.ID)
+	like := &Like{}
+	err := m.DB.QueryRowContext(ctx, query, user.ID, comment.ID).Scan(&like.Count)
 	if err == sql.ErrNoRows {
-		return ErrRecordNotFound
+		return nil, ErrRecordNotFound
 	} else if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return like, nil
 }
 
-func (m *UserModel) ChangeName(user *User, name string) error {
+func (m *UserModel) ChangeName(ctx context.Context, user *User, name string) error {
 	query := `
 		UPDATE users
 		SET name = $1, version = version + 1
 		WHERE users.id = $2 AND version = $3`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, name, user.ID, user.Version)
-	if err == sql.ErrNoRows {
-		return ErrEditConflict
-	} else if err != nil {
+	result, err := m.DB.ExecContext(ctx, query, name, user.ID, user.Version)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
 		return err
 	}
+	if rows == 0 {
+		return ErrEditConflict
+	}
 
 	return nil
 }
 
-func (m *UserModel) ChangePassword(user *User, oldPass, newPass string) error {
+func (m *UserModel) ChangePassword(ctx context.Context, user *User, oldPass, newPass string) error {
 	var hashedPassword []byte
 
 	query := `
@@ -447,7 +603,7 @@ func (m *UserModel) ChangePassword(user *User, oldPass, newPass string) error {
 		FROM users
 		WHERE id = $1 AND version = $2`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	err := m.DB.QueryRowContext(ctx, query, user.ID, user.Version).Scan(&hashedPassword)
@@ -484,14 +640,14 @@ func (m *UserModel) ChangePassword(user *User, oldPass, newPass string) error {
 	return nil
 }
 
-func (m *UserModel) HasPublication(user *User) (bool, error) {
+func (m *UserModel) HasPublication(ctx context.Context, user *User) (bool, error) {
 	query := `
 		SELECT 1
 		FROM writes_on
 		WHERE user_id = $1
 		LIMIT 1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	exists := 0
@@ -505,14 +661,14 @@ func (m *UserModel) HasPublication(user *User) (bool, error) {
 	return exists == 1, nil
 }
 
-func (m *UserModel) HasInvitations(user *User) (bool, error) {
+func (m *UserModel) HasInvitations(ctx context.Context, user *User) (bool, error) {
 	query := `
 		SELECT 1
 		FROM invitation
 		WHERE user_id = $1
 		LIMIT 1`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := m.DB.timeout(ctx)
 	defer cancel()
 
 	exists := 0
@@ -525,3 +681,130 @@ func (m *UserModel) HasInvitations(user *User) (bool, error) {
 
 	return exists == 1, nil
 }
+
+func (m *UserModel) Follow(ctx context.Context, user, followee *User) error {
+	query := `
+		INSERT INTO follows (follower_id, followee_id)
+		VALUES ($1, $2)
+		ON CONFLICT ON CONSTRAINT follows_pk DO NOTHING`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, user.ID, followee.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) Unfollow(ctx context.Context, user, followee *User) error {
+	query := `
+		DELETE FROM follows
+		WHERE follower_id = $1 AND followee_id = $2`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, user.ID, followee.ID)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) IsFollowing(ctx context.Context, user, followee *User) (bool, error) {
+	if user == nil || followee == nil {
+		return false, nil
+	}
+
+	query := `
+		SELECT 1
+		FROM follows
+		WHERE follower_id = $1 AND followee_id = $2
+		LIMIT 1`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	exists := 0
+	err := m.DB.QueryRowContext(ctx, query, user.ID, followee.ID).Scan(&exists)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return exists == 1, nil
+}
+
+// FollowCounts returns how many users follow the user and how many users the
+// user follows.
+func (m *UserModel) FollowCounts(ctx context.Context, user *User) (int, int, error) {
+	query := `
+		SELECT
+			(SELECT count(*) FROM follows WHERE followee_id = $1),
+			(SELECT count(*) FROM follows WHERE follower_id = $1)`
+
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	var followers, following int
+	err := m.DB.QueryRowContext(ctx, query, user.ID).Scan(&followers, &following)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return followers, following, nil
+}
+
+func (m *UserModel) Followers(ctx context.Context, user *User) ([]*User, error) {
+	stmt := `
+		SELECT users.id, users.name, users.email, users.created_at, users.image_id
+		FROM follows
+		JOIN users ON users.id = follows.follower_id
+		WHERE follows.followee_id = $1
+		ORDER BY follows.created_at DESC, follows.follower_id DESC`
+
+	return m.follows(ctx, stmt, user)
+}
+
+func (m *UserModel) Following(ctx context.Context, user *User) ([]*User, error) {
+	stmt := `
+		SELECT users.id, users.name, users.email, users.created_at, users.image_id
+		FROM follows
+		JOIN users ON users.id = follows.followee_id
+		WHERE follows.follower_id = $1
+		ORDER BY follows.created_at DESC, follows.followee_id DESC`
+
+	return m.follows(ctx, stmt, user)
+}
+
+func (m *UserModel) follows(ctx context.Context, stmt string, user *User) ([]*User, error) {
+	ctx, cancel := m.DB.timeout(ctx)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, stmt, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u := &User{}
+		err = rows.Scan(&u.ID, &u.Name, &u.Email, &u.CreatedAt, &u.ImageID)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
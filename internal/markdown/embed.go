@@ -0,0 +1,145 @@
+package markdown
+
+import (
+	"context"
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/microcosm-cc/bluemonday"
+	"html"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Embed expands a shortcode like {{< youtube id >}}, written as a paragraph
+// of its own, into rich content.
+type Embed struct {
+	// Render returns the HTML of the shortcode with the arguments, which is
+	// sanitised like the rest of the article, and false if the arguments
+	// don't name anything it can embed.
+	Render func(ctx context.Context, args []string) (string, bool)
+	// Frames matches the URLs the embed loads in a frame once clicked, nil
+	// for embeds rendered natively.
+	Frames *regexp.Regexp
+}
+
+// defaultEmbeds are the shortcodes of third parties. Their content is shown
+// as a facade that loads it only when clicked, so reading an article shares
+// nothing with them.
+func defaultEmbeds() map[string]Embed {
+	return map[string]Embed{
+		"youtube": {
+			Render: func(ctx context.Context, args []string) (string, bool) {
+				if len(args) != 1 || !youtubeID.MatchString(args[0]) {
+					return "", false
+				}
+				return facade("youtube", "YouTube", "video",
+					"https://www.youtube-nocookie.com/embed/"+args[0],
+					"https://www.youtube.com/watch?v="+args[0]), true
+			},
+			Frames: regexp.MustCompile(`^https://www\.youtube-nocookie\.com/embed/[A-Za-z0-9_-]{11}$`),
+		},
+		"vimeo": {
+			Render: func(ctx context.Context, args []string) (string, bool) {
+				if len(args) != 1 || !vimeoID.MatchString(args[0]) {
+					return "", false
+				}
+				return facade("vimeo", "Vimeo", "video",
+					"https://player.vimeo.com/video/"+args[0]+"?dnt=1",
+					"https://vimeo.com/"+args[0]), true
+			},
+			Frames: regexp.MustCompile(`^https://player\.vimeo\.com/video/[0-9]+\?dnt=1$`),
+		},
+		"gist": {
+			Render: func(ctx context.Context, args []string) (string, bool) {
+				if len(args) != 2 || !githubUser.MatchString(args[0]) || !gistID.MatchString(args[1]) {
+					return "", false
+				}
+				gist := "https://gist.github.com/" + args[0] + "/" + args[1]
+				return facade("gist", "GitHub", "gist", gist+".js", gist), true
+			},
+			Frames: regexp.MustCompile(`^https://gist\.github\.com/[A-Za-z0-9-]+/[0-9a-f]+\.js$`),
+		},
+	}
+}
+
+var (
+	youtubeID  = regexp.MustCompile(`^[A-Za-z0-9_-]{11}$`)
+	vimeoID    = regexp.MustCompile(`^[0-9]+$`)
+	githubUser = regexp.MustCompile(`^[A-Za-z0-9-]+$`)
+	gistID     = regexp.MustCompile(`^[0-9a-f]+$`)
+
+	shortcode = regexp.MustCompile(`^\{\{<\s*([a-z]+)((?:\s+[^\s>]+)*)\s*>\}\}$`)
+)
+
+// facade returns a placeholder for content of a third party, linking to it.
+// embed.js replaces it with a frame of src when the link is clicked.
+func facade(name, provider, kind, src, link string) string {
+	return fmt.Sprintf(`<div class="embed embed-%s" data-embed-src="%s">`+
+		`<p><a class="embed-load" href="%s">Load the %s from %s</a></p>`+
+		`<p class="embed-note">Loading it shares your visit with %s.</p></div>`+"\n",
+		name, html.EscapeString(src), html.EscapeString(link), kind, provider, provider)
+}
+
+// embedded is noted about the paragraphs expanded into embeds.
+type embedded struct{}
+
+// renderEmbed writes the embed a paragraph is the shortcode of.
+func (p *Pipeline) renderEmbed(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	paragraph, ok := node.(*ast.Paragraph)
+	if !ok {
+		return ast.GoToNext, false
+	}
+	if !entering {
+		_, ok := doc.NoteOf(paragraph).(embedded)
+		return ast.GoToNext, ok
+	}
+
+	if len(paragraph.Children) != 1 {
+		return ast.GoToNext, false
+	}
+	text, ok := paragraph.Children[0].(*ast.Text)
+	if !ok {
+		return ast.GoToNext, false
+	}
+	m := shortcode.FindStringSubmatch(strings.TrimSpace(string(text.Literal)))
+	if m == nil {
+		return ast.GoToNext, false
+	}
+	e, ok := p.Embeds[m[1]]
+	if !ok {
+		return ast.GoToNext, false
+	}
+
+	out, ok := e.Render(doc.Context, strings.Fields(m[2]))
+	if !ok {
+		return ast.GoToNext, false
+	}
+	io.WriteString(w, out)
+	doc.Note(paragraph, embedded{})
+	return ast.SkipChildren, true
+}
+
+// allowEmbeds lets the markup of embeds through the policy, with frame URLs
+// only of the third parties there are embeds of.
+func (p *Pipeline) allowEmbeds(policy *bluemonday.Policy, opts Options) {
+	var names, frames []string
+	for name, e := range p.Embeds {
+		names = append(names, name)
+		if e.Frames != nil {
+			frames = append(frames, e.Frames.String())
+		}
+	}
+	sort.Strings(names)
+	sort.Strings(frames)
+
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed embed-(` + strings.Join(names, "|") + `)$`)).
+		OnElements("div")
+	if len(frames) > 0 {
+		policy.AllowAttrs("data-embed-src").Matching(regexp.MustCompile(`(` + strings.Join(frames, ")|(") + `)`)).
+			OnElements("div")
+	}
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed-load$`)).OnElements("a")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^embed-note$`)).OnElements("p")
+}
@@ -0,0 +1,257 @@
+package markdown
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/microcosm-cc/bluemonday"
+	"html"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// HeadingIDPrefix keeps the ids of headings in articles apart from the ids
+// of the page around them.
+const HeadingIDPrefix = "h-"
+
+// Feature is an extension of Markdown a publication can enable for its
+// articles.
+type Feature struct {
+	Name        string
+	Label       string
+	Description string
+}
+
+// Features are the extensions there are.
+var Features = []Feature{
+	{Name: "anchors", Label: "Heading anchors", Description: "Headings get stable ids and a link to themselves."},
+	{Name: "toc", Label: "Table of contents", Description: "A paragraph of just [TOC] lists the headings."},
+	{Name: "footnotes", Label: "Footnotes", Description: "Text[^1] refers to a note written as [^1]: Note."},
+	{Name: "math", Label: "Math", Description: "TeX between $ or $$ is typeset, like $e^{i\\pi} + 1 = 0$."},
+	{Name: "admonitions", Label: "Admonitions", Description: "Quotes starting with [!NOTE], [!TIP] or [!WARNING] stand out."},
+}
+
+// ValidFeature reports whether there is an extension of the name.
+func ValidFeature(name string) bool {
+	for _, f := range Features {
+		if f.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueHeadingIDs makes the ids of headings unique up front, so that the
+// table of contents links to the ids rendered.
+func uniqueHeadingIDs(doc *Document) {
+	ids := map[string]bool{}
+
+	ast.WalkFunc(doc.Root, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.HeadingID == "" {
+			return ast.GoToNext
+		}
+		id := heading.HeadingID
+		for n := 1; ids[id]; n++ {
+			id = heading.HeadingID + "-" + strconv.Itoa(n)
+		}
+		ids[id] = true
+		heading.HeadingID = id
+		doc.headings = append(doc.headings, heading)
+		return ast.GoToNext
+	})
+}
+
+var admonitionMarker = regexp.MustCompile(`^\[!(?i:(note|tip|warning))\][ \t]*\n?`)
+
+var admonitionTitles = map[string]string{"note": "Note", "tip": "Tip", "warning": "Warning"}
+
+// admonition is noted about the quotes that are admonitions.
+type admonition struct {
+	kind string
+}
+
+// markAdmonitions takes the markers off admonitions, noting their kind.
+func markAdmonitions(doc *Document) {
+	if !doc.Options.Has("admonitions") {
+		return
+	}
+
+	ast.WalkFunc(doc.Root, func(node ast.Node, entering bool) ast.WalkStatus {
+		quote, ok := node.(*ast.BlockQuote)
+		if !ok || !entering || len(quote.Children) == 0 {
+			return ast.GoToNext
+		}
+		paragraph, ok := quote.Children[0].(*ast.Paragraph)
+		if !ok || len(paragraph.Children) == 0 {
+			return ast.GoToNext
+		}
+		text, ok := paragraph.Children[0].(*ast.Text)
+		if !ok {
+			return ast.GoToNext
+		}
+		m := admonitionMarker.FindSubmatchIndex(text.Literal)
+		if m == nil {
+			return ast.GoToNext
+		}
+		doc.Note(quote, admonition{strings.ToLower(string(text.Literal[m[2]:m[3]]))})
+		text.Literal = text.Literal[m[1]:]
+		if len(text.Literal) == 0 && len(paragraph.Children) == 1 {
+			ast.RemoveFromTree(paragraph)
+		}
+		return ast.GoToNext
+	})
+}
+
+func renderHeadingAnchor(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	heading, ok := node.(*ast.Heading)
+	if !ok || entering || heading.HeadingID == "" || !doc.Options.Has("anchors") {
+		return ast.GoToNext, false
+	}
+	fmt.Fprintf(w, `<a class="heading-anchor" href="#%s" aria-label="Link to this section">#</a></h%d>`+"\n",
+		html.EscapeString(HeadingIDPrefix+heading.HeadingID), heading.Level)
+	return ast.GoToNext, true
+}
+
+func renderTOC(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	paragraph, ok := node.(*ast.Paragraph)
+	if !ok || !doc.Options.Has("toc") || !isTOCMarker(paragraph) {
+		return ast.GoToNext, false
+	}
+	if entering {
+		writeTOC(w, doc.headings)
+	}
+	return ast.SkipChildren, true
+}
+
+func renderAdmonition(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	a, ok := doc.NoteOf(node).(admonition)
+	if !ok {
+		return ast.GoToNext, false
+	}
+	if entering {
+		fmt.Fprintf(w, "<div class=\"admonition admonition-%s\">\n<p class=\"admonition-title\">%s</p>\n",
+			a.kind, admonitionTitles[a.kind])
+	} else {
+		io.WriteString(w, "</div>\n")
+	}
+	return ast.GoToNext, true
+}
+
+func renderMath(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch node := node.(type) {
+	case *ast.Math:
+		writeMath(w, node.Literal, false)
+		return ast.GoToNext, true
+	case *ast.MathBlock:
+		if entering {
+			writeMath(w, node.Literal, true)
+		}
+		return ast.GoToNext, true
+	}
+	return ast.GoToNext, false
+}
+
+func isTOCMarker(paragraph *ast.Paragraph) bool {
+	if len(paragraph.Children) != 1 {
+		return false
+	}
+	text, ok := paragraph.Children[0].(*ast.Text)
+	return ok && string(bytes.TrimSpace(text.Literal)) == "[TOC]"
+}
+
+// writeTOC writes the headings as nested lists.
+func writeTOC(w io.Writer, headings []*ast.Heading) {
+	if len(headings) == 0 {
+		return
+	}
+
+	top := headings[0].Level
+	for _, h := range headings {
+		if h.Level < top {
+			top = h.Level
+		}
+	}
+
+	io.WriteString(w, "<nav class=\"toc\">\n<ul>\n")
+	level := top
+	for i, h := range headings {
+		switch {
+		case i == 0:
+			io.WriteString(w, "<li>"+strings.Repeat("\n<ul>\n<li>", h.Level-top))
+		case h.Level > level:
+			io.WriteString(w, strings.Repeat("\n<ul>\n<li>", h.Level-level))
+		default:
+			io.WriteString(w, "</li>\n")
+			for ; level > h.Level && level > top; level-- {
+				io.WriteString(w, "</ul>\n</li>\n")
+			}
+			io.WriteString(w, "<li>")
+		}
+		level = h.Level
+		fmt.Fprintf(w, `<a href="#%s">%s</a>`, html.EscapeString(HeadingIDPrefix+h.HeadingID),
+			html.EscapeString(plainText(h)))
+	}
+	io.WriteString(w, "</li>\n")
+	for ; level > top; level-- {
+		io.WriteString(w, "</ul>\n</li>\n")
+	}
+	io.WriteString(w, "</ul>\n</nav>\n")
+}
+
+// plainText returns the text of the node without its markup.
+func plainText(node ast.Node) string {
+	var b strings.Builder
+	ast.WalkFunc(node, func(node ast.Node, entering bool) ast.WalkStatus {
+		if leaf := node.AsLeaf(); leaf != nil && entering {
+			b.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return b.String()
+}
+
+// writeMath typesets a formula to MathML, or writes its source as code if
+// it is beyond what texToMathML understands.
+func writeMath(w io.Writer, tex []byte, display bool) {
+	mathML, err := texToMathML(string(tex), display)
+	if err != nil && display {
+		fmt.Fprintf(w, "<pre><code>%s</code></pre>\n", html.EscapeString(strings.TrimSpace(string(tex))))
+		return
+	} else if err != nil {
+		fmt.Fprintf(w, `<code>%s</code>`, html.EscapeString(string(tex)))
+		return
+	}
+	if display {
+		io.WriteString(w, "<p>"+mathML+"</p>\n")
+		return
+	}
+	io.WriteString(w, mathML)
+}
+
+// allowExtensions lets the markup of the extensions through the policy: the
+// classes of anchors, footnotes and admonitions, and the MathML formulas
+// are typeset in. Ids the policy allows already.
+func allowExtensions(policy *bluemonday.Policy, opts Options) {
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^(heading-anchor|footnote-return)$`)).OnElements("a")
+	policy.AllowAttrs("aria-label").OnElements("a")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^footnote-ref$`)).OnElements("sup")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^(footnotes|admonition admonition-(note|tip|warning))$`)).
+		OnElements("div")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^admonition-title$`)).OnElements("p")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^toc$`)).OnElements("nav")
+
+	policy.AllowNoAttrs().OnElements("semantics", "mrow", "mi", "mn", "mo", "mtext", "msub", "msup", "msubsup",
+		"munder", "mover", "munderover", "mfrac", "msqrt", "mroot", "mtable", "mtr", "mtd", "merror")
+	policy.AllowAttrs("xmlns").Matching(regexp.MustCompile(`^http://www\.w3\.org/1998/Math/MathML$`)).
+		OnElements("math")
+	policy.AllowAttrs("display").Matching(regexp.MustCompile(`^(block|inline)$`)).OnElements("math")
+	policy.AllowAttrs("encoding").Matching(regexp.MustCompile(`^application/x-tex$`)).OnElements("annotation")
+	policy.AllowAttrs("mathvariant").Matching(regexp.MustCompile(`^normal$`)).OnElements("mi")
+	policy.AllowAttrs("fence", "stretchy").Matching(regexp.MustCompile(`^(true|false)$`)).OnElements("mo")
+	policy.AllowAttrs("accent").Matching(regexp.MustCompile(`^true$`)).OnElements("mover")
+	policy.AllowAttrs("linethickness").Matching(regexp.MustCompile(`^0$`)).OnElements("mfrac")
+	policy.AllowAttrs("width").Matching(regexp.MustCompile(`^-?[0-9.]+em$`)).OnElements("mspace")
+}
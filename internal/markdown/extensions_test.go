@@ -0,0 +1,91 @@
+package markdown
+
+import (
+	"context"
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	"strings"
+	"testing"
+)
+
+func TestWriteTOC(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []int
+		want   string
+	}{
+		{"none", nil, ``},
+		{"flat", []int{2, 2}, `<ul><li>[0]</li><li>[1]</li></ul>`},
+		{"nested", []int{1, 2, 2}, `<ul><li>[0]<ul><li>[1]</li><li>[2]</li></ul></li></ul>`},
+		{"skips a level", []int{1, 3}, `<ul><li>[0]<ul><li><ul><li>[1]</li></ul></li></ul></li></ul>`},
+		{"skips a level and back", []int{1, 3, 2},
+			`<ul><li>[0]<ul><li><ul><li>[1]</li></ul></li><li>[2]</li></ul></li></ul>`},
+		{"skips a level and back to the top", []int{1, 3, 1},
+			`<ul><li>[0]<ul><li><ul><li>[1]</li></ul></li></ul></li><li>[2]</li></ul>`},
+		{"starts below the top", []int{3, 1},
+			`<ul><li><ul><li><ul><li>[0]</li></ul></li></ul></li><li>[1]</li></ul>`},
+		{"closes several levels", []int{1, 2, 3, 4, 1},
+			`<ul><li>[0]<ul><li>[1]<ul><li>[2]<ul><li>[3]</li></ul></li></ul></li></ul></li><li>[4]</li></ul>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var headings []*ast.Heading
+			var links []string
+			for i, level := range tt.levels {
+				h := &ast.Heading{Level: level, HeadingID: fmt.Sprint("s", i)}
+				ast.AppendChild(h, &ast.Text{Leaf: ast.Leaf{Literal: []byte(fmt.Sprint("Section ", i))}})
+				headings = append(headings, h)
+				links = append(links, fmt.Sprintf("[%d]", i), fmt.Sprintf(`<a href="#h-s%d">Section %d</a>`, i, i))
+			}
+
+			var b strings.Builder
+			writeTOC(&b, headings)
+			got := strings.ReplaceAll(b.String(), "\n", "")
+
+			want := ""
+			if tt.want != "" {
+				want = `<nav class="toc">` + strings.NewReplacer(links...).Replace(tt.want) + `</nav>`
+			}
+			if got != want {
+				t.Errorf("writeTOC(%v)\ngot:  %s\nwant: %s", tt.levels, got, want)
+			}
+		})
+	}
+}
+
+// TestAllowExtensions renders documents with the extensions and checks
+// that the policy lets all of their markup through untouched.
+func TestAllowExtensions(t *testing.T) {
+	p := &Pipeline{
+		Parse:      parse,
+		Transforms: []Transform{uniqueHeadingIDs, markAdmonitions},
+		Renderers:  []NodeRenderer{renderHeadingAnchor, renderTOC, renderAdmonition, renderMath},
+	}
+	opts := Options{Features: allFeatures()}
+
+	policy := basePolicy(opts.Tables)
+	allowExtensions(policy, opts)
+
+	math := []string{`\frac{a}{b}`, `\binom{n}{k}`, `x_i^{n+1}`, `f'`, `\sum_{i=1}^n i`, `\lim_{x\to 0}`,
+		`\sqrt[3]{x}`, `\hat{x}`, `\left(x\right)`, `\text{if } x < 0`, `a\,b\quad c`, `\mathrm{d}x`,
+		`\mathbb{R}`, `\Gamma`, `\foo`, `\begin{cases}0 & x<0\\1\end{cases}`, `\begin{bmatrix}1 & 2\end{bmatrix}`}
+
+	docs := map[string]string{
+		"anchors and toc": "[TOC]\n\n# One\n\n## Two\n\n#### Four\n\n# One\n",
+		"footnotes":       "Text[^1] and more[^note].\n\n[^1]: A note.\n[^note]: Another.\n",
+		"admonitions":     "> [!NOTE]\n> Note.\n\n---\n\n> [!TIP] Tip.\n\n---\n\n> [!WARNING]\n> Warning.\n",
+		"inline math":     "$" + strings.Join(math, "$ and $") + "$\n",
+		"display math":    "$$\n" + strings.Join(math, "\n$$\n\n$$\n") + "\n$$\n",
+	}
+
+	for name, src := range docs {
+		t.Run(name, func(t *testing.T) {
+			doc := &Document{Context: context.Background(), Options: opts}
+			rendered := string(p.render(doc, src))
+			if sanitised := policy.Sanitize(rendered); sanitised != rendered {
+				t.Errorf("policy changed the markup\nrendered:  %s\nsanitised: %s", rendered, sanitised)
+			}
+		})
+	}
+}
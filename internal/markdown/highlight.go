@@ -0,0 +1,119 @@
+package markdown
+
+import (
+	"bytes"
+	"github.com/alecthomas/chroma"
+	chromahtml "github.com/alecthomas/chroma/formatters/html"
+	"github.com/alecthomas/chroma/lexers"
+	"github.com/alecthomas/chroma/styles"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/microcosm-cc/bluemonday"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fenceInfo is what the info string of a fenced code block asks for. Beyond
+// the language the info string goes in braces, like "{go hl=3,5-7 linenos}"
+// for Go with lines 3 and 5 to 7 highlighted and line numbers shown.
+type fenceInfo struct {
+	lang      string
+	highlight [][2]int
+	linenos   bool
+}
+
+func parseFenceInfo(info string) fenceInfo {
+	var fi fenceInfo
+	for i, field := range strings.Fields(info) {
+		switch {
+		case strings.HasPrefix(field, "hl="):
+			fi.highlight = parseLineRanges(strings.TrimPrefix(field, "hl="))
+		case field == "linenos":
+			fi.linenos = true
+		case i == 0:
+			fi.lang = field
+		}
+	}
+	return fi
+}
+
+// parseLineRanges parses a comma separated list of lines and ranges of
+// lines, skipping what doesn't parse.
+func parseLineRanges(s string) [][2]int {
+	var ranges [][2]int
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(strings.TrimSpace(part), "-")
+		start, err := strconv.Atoi(from)
+		if err != nil || start < 1 {
+			continue
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(to)
+			if err != nil || end < start {
+				continue
+			}
+		}
+		ranges = append(ranges, [2]int{start, end})
+	}
+	return ranges
+}
+
+// renderCodeBlock highlights fenced code blocks by the language of their
+// info string. The markup only carries classes, the colours come from the
+// stylesheet of the style the publication picked.
+func renderCodeBlock(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	block, ok := node.(*ast.CodeBlock)
+	if !ok || !block.IsFenced {
+		return ast.GoToNext, false
+	}
+
+	fi := parseFenceInfo(string(block.Info))
+	lexer := lexers.Get(fi.lang)
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	iterator, err := lexer.Tokenise(nil, string(block.Literal))
+	if err != nil {
+		return ast.GoToNext, false
+	}
+
+	formatter := chromahtml.New(
+		chromahtml.WithClasses(true),
+		chromahtml.WithLineNumbers(fi.linenos),
+		chromahtml.HighlightLines(fi.highlight),
+		chromahtml.TabWidth(4),
+	)
+
+	// format into a buffer so that a failure falls back on the plain block
+	var buf bytes.Buffer
+	err = formatter.Format(&buf, styles.Fallback, iterator)
+	if err != nil {
+		return ast.GoToNext, false
+	}
+	w.Write(buf.Bytes())
+
+	return ast.GoToNext, true
+}
+
+// allowHighlighting lets the classes of highlighted code blocks through the
+// policy, and no other class.
+func allowHighlighting(policy *bluemonday.Policy, opts Options) {
+	classes := []string{"chroma", "line", "cl", "ln", "hl"}
+	for _, class := range chroma.StandardTypes {
+		if class != "" {
+			classes = append(classes, class)
+		}
+	}
+	sort.Strings(classes)
+	for i := range classes {
+		classes[i] = regexp.QuoteMeta(classes[i])
+	}
+
+	class := regexp.MustCompile(`^(` + strings.Join(classes, "|") + `)( (` + strings.Join(classes, "|") + `))*$`)
+	policy.AllowAttrs("class").Matching(class).OnElements("pre", "code", "span")
+}
@@ -0,0 +1,62 @@
+package markdown
+
+import (
+	"bytes"
+	"golang.org/x/net/html"
+	"io"
+	"strings"
+)
+
+// externalRel is the rel of links out of the site: the page linked gets no
+// handle on the article, and search engines learn that writers, not the
+// site, vouch for it.
+const externalRel = "noopener nofollow ugc"
+
+// externalLinks sets the rel of the links of the document to other sites.
+// Links within the site, which are relative, are left alone.
+func externalLinks(doc *Document, in []byte) []byte {
+	var out bytes.Buffer
+	z := html.NewTokenizer(bytes.NewReader(in))
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if z.Err() != io.EOF {
+				// the sanitiser wrote it, so this doesn't happen, but the
+				// HTML is safe as it is
+				return in
+			}
+			return out.Bytes()
+		case html.StartTagToken:
+			token := z.Token()
+			if token.Data == "a" && isExternal(token) {
+				setAttr(&token, "rel", externalRel)
+				out.WriteString(token.String())
+				continue
+			}
+		}
+		out.Write(z.Raw())
+	}
+}
+
+func isExternal(token html.Token) bool {
+	for _, attr := range token.Attr {
+		if attr.Key == "href" {
+			href := strings.ToLower(attr.Val)
+			return strings.HasPrefix(href, "http://") || strings.HasPrefix(href, "https://") ||
+				strings.HasPrefix(href, "//")
+		}
+	}
+	return false
+}
+
+func setAttr(token *html.Token, key, val string) {
+	for i, attr := range token.Attr {
+		if attr.Key == key {
+			token.Attr[i].Val = val
+			return
+		}
+	}
+	token.Attr = append(token.Attr, html.Attribute{Key: key, Val: val})
+}
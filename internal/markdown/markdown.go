@@ -0,0 +1,207 @@
+// Package markdown renders the Markdown of articles to sanitised HTML.
+//
+// Rendering goes through the stages of a Pipeline: the source is parsed to a
+// tree, transforms change the tree, node renderers render the nodes the
+// html renderer has no markup for, the policy built for the options
+// sanitises the HTML and post-processing changes the sanitised HTML. Each
+// stage can be extended by appending to the pipeline before rendering.
+package markdown
+
+import (
+	"context"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"github.com/microcosm-cc/bluemonday"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Options configure the rendering of a document, they are set per
+// publication.
+type Options struct {
+	// Features names the extensions of Markdown enabled, out of Features.
+	Features []string
+	// Tables lets tables through the policy.
+	Tables bool
+	// FrameHosts are the hosts iframes written in the HTML of articles may
+	// load pages from.
+	FrameHosts []string
+}
+
+// Has reports whether the extension is enabled.
+func (o Options) Has(feature string) bool {
+	for _, f := range o.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// policyKey identifies the policy the options are sanitised with.
+func (o Options) policyKey() string {
+	hosts := append([]string(nil), o.FrameHosts...)
+	sort.Strings(hosts)
+	return strconv.FormatBool(o.Tables) + " " + strings.Join(hosts, " ")
+}
+
+// Document is the state of one rendering, shared by its stages.
+type Document struct {
+	Context context.Context
+	Options Options
+	Root    ast.Node
+
+	// notes hold what stages noted about nodes for later stages
+	notes map[ast.Node]any
+
+	headings []*ast.Heading
+}
+
+// Note keeps a value about the node for later stages.
+func (d *Document) Note(node ast.Node, v any) {
+	if d.notes == nil {
+		d.notes = map[ast.Node]any{}
+	}
+	d.notes[node] = v
+}
+
+// NoteOf returns the value noted about the node, nil if there is none.
+func (d *Document) NoteOf(node ast.Node) any {
+	return d.notes[node]
+}
+
+type (
+	// Parse turns the source into the tree of a document.
+	Parse func(doc *Document, src []byte) ast.Node
+	// Transform changes the tree of a document before it is rendered.
+	Transform func(doc *Document)
+	// NodeRenderer renders a node in place of the html renderer, reporting
+	// whether it did.
+	NodeRenderer func(doc *Document, w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool)
+	// PolicyRule adds to the policy the HTML rendered with the options is
+	// sanitised with.
+	PolicyRule func(policy *bluemonday.Policy, opts Options)
+	// PostProcess changes the sanitised HTML of a document.
+	PostProcess func(doc *Document, html []byte) []byte
+)
+
+// Pipeline renders Markdown to sanitised HTML. Its stages must not be
+// changed once it has rendered, the policies built are kept.
+type Pipeline struct {
+	Parse       Parse
+	Transforms  []Transform
+	Renderers   []NodeRenderer
+	Policy      []PolicyRule
+	PostProcess []PostProcess
+	// Embeds are the shortcodes expanded, by name.
+	Embeds map[string]Embed
+
+	mu       sync.Mutex
+	policies map[string]*bluemonday.Policy
+}
+
+// New returns a pipeline with the stages of the extensions there are.
+func New() *Pipeline {
+	p := &Pipeline{
+		Parse:      parse,
+		Transforms: []Transform{uniqueHeadingIDs, markAdmonitions},
+		Embeds:     defaultEmbeds(),
+	}
+	p.Renderers = []NodeRenderer{
+		renderCodeBlock,
+		renderHeadingAnchor,
+		renderTOC,
+		p.renderEmbed,
+		renderAdmonition,
+		renderMath,
+	}
+	p.Policy = []PolicyRule{allowHighlighting, allowExtensions, p.allowEmbeds, allowFrames}
+	p.PostProcess = []PostProcess{externalLinks}
+	return p
+}
+
+// Render renders the Markdown with the options.
+func (p *Pipeline) Render(ctx context.Context, src string, opts Options) []byte {
+	doc := &Document{Context: ctx, Options: opts}
+	out := p.policy(opts).SanitizeBytes(p.render(doc, src))
+
+	for _, process := range p.PostProcess {
+		out = process(doc, out)
+	}
+	return out
+}
+
+// render parses, transforms and renders the document, up to the HTML that
+// is yet to be sanitised.
+func (p *Pipeline) render(doc *Document, src string) []byte {
+	doc.Root = p.Parse(doc, markdown.NormalizeNewlines([]byte(src)))
+
+	for _, transform := range p.Transforms {
+		transform(doc)
+	}
+
+	// renderers keep state while rendering, so each document gets its own
+	renderer := html.NewRenderer(html.RendererOptions{
+		Flags:                      html.CommonFlags | html.FootnoteReturnLinks,
+		HeadingIDPrefix:            HeadingIDPrefix,
+		FootnoteReturnLinkContents: "↩",
+		RenderNodeHook: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			for _, render := range p.Renderers {
+				if status, ok := render(doc, w, node, entering); ok {
+					return status, true
+				}
+			}
+			return ast.GoToNext, false
+		},
+	})
+
+	return markdown.Render(doc.Root, renderer)
+}
+
+// policy returns the policy for the options, building it the first time.
+func (p *Pipeline) policy(opts Options) *bluemonday.Policy {
+	key := opts.policyKey()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if policy, ok := p.policies[key]; ok {
+		return policy
+	}
+
+	policy := basePolicy(opts.Tables)
+	for _, rule := range p.Policy {
+		rule(policy, opts)
+	}
+
+	if p.policies == nil {
+		p.policies = map[string]*bluemonday.Policy{}
+	}
+	p.policies[key] = policy
+	return policy
+}
+
+// parse parses the source with the extensions enabled. Tables a publication
+// doesn't allow stay text rather than lose their markup to the policy.
+func parse(doc *Document, src []byte) ast.Node {
+	extensions := parser.CommonExtensions &^ parser.MathJax
+	if !doc.Options.Tables {
+		extensions &^= parser.Tables
+	}
+	if doc.Options.Has("anchors") || doc.Options.Has("toc") {
+		extensions |= parser.AutoHeadingIDs
+	}
+	if doc.Options.Has("footnotes") {
+		extensions |= parser.Footnotes
+	}
+	if doc.Options.Has("math") {
+		extensions |= parser.MathJax
+	}
+
+	return markdown.Parse(src, parser.NewWithExtensions(extensions))
+}
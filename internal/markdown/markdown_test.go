@@ -0,0 +1,73 @@
+package markdown
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of the tests")
+
+// allFeatures enables every extension there is.
+func allFeatures() []string {
+	var names []string
+	for _, f := range Features {
+		names = append(names, f.Name)
+	}
+	return names
+}
+
+// goldenOptions are the options testdata/<name>.md is rendered with, by
+// name. Documents not listed get every extension and tables.
+var goldenOptions = map[string]Options{
+	"parse_plain": {},
+	"policy":      {Features: allFeatures(), Tables: true, FrameHosts: []string{"frames.example.com"}},
+}
+
+// TestGolden renders each testdata/*.md and compares the HTML with the
+// .html next to it. Run with -update to rewrite the golden files.
+func TestGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) == 0 {
+		t.Fatal("no golden files in testdata")
+	}
+
+	p := New()
+	for _, source := range sources {
+		name := strings.TrimSuffix(filepath.Base(source), ".md")
+		t.Run(name, func(t *testing.T) {
+			src, err := os.ReadFile(source)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts, ok := goldenOptions[name]
+			if !ok {
+				opts = Options{Features: allFeatures(), Tables: true}
+			}
+
+			got := p.Render(context.Background(), string(src), opts)
+
+			golden := strings.TrimSuffix(source, ".md") + ".html"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("rendered HTML differs from %s\ngot:\n%s\nwant:\n%s", golden, got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,536 @@
+package markdown
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// texToMathML renders a formula in the subset of TeX that KaTeX takes to
+// MathML, which browsers lay out themselves. The source is kept as an
+// annotation so that it can be copied out.
+func texToMathML(tex string, display bool) (string, error) {
+	p := &texParser{src: tex, display: display}
+	body, err := p.parseList("")
+	if err != nil {
+		return "", err
+	}
+	if p.peek() != "" {
+		return "", errUnbalanced
+	}
+
+	mode := "inline"
+	if display {
+		mode = "block"
+	}
+	return fmt.Sprintf(`<math xmlns="http://www.w3.org/1998/Math/MathML" display="%s"><semantics>%s`+
+		`<annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+		mode, mathRow(body), html.EscapeString(strings.TrimSpace(tex))), nil
+}
+
+var errUnbalanced = errors.New("unbalanced braces")
+
+var texGreek = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+}
+
+var texSymbols = map[string]string{
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "varnothing": "∅",
+	"hbar": "ℏ", "ell": "ℓ", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ", "prime": "′",
+}
+
+var texOperators = map[string]string{
+	"times": "×", "cdot": "⋅", "pm": "±", "mp": "∓", "div": "÷", "ast": "∗", "circ": "∘",
+	"leq": "≤", "le": "≤", "geq": "≥", "ge": "≥", "neq": "≠", "ne": "≠", "approx": "≈",
+	"equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅", "propto": "∝", "ll": "≪", "gg": "≫",
+	"to": "→", "rightarrow": "→", "leftarrow": "←", "leftrightarrow": "↔", "mapsto": "↦",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "implies": "⟹", "iff": "⟺",
+	"in": "∈", "notin": "∉", "ni": "∋", "subset": "⊂", "subseteq": "⊆", "supset": "⊃",
+	"supseteq": "⊇", "cup": "∪", "cap": "∩", "setminus": "∖", "wedge": "∧", "land": "∧",
+	"vee": "∨", "lor": "∨", "neg": "¬", "lnot": "¬", "forall": "∀", "exists": "∃",
+	"cdots": "⋯", "ldots": "…", "dots": "…", "vdots": "⋮", "ddots": "⋱", "mid": "∣",
+	"parallel": "∥", "perp": "⊥", "oplus": "⊕", "otimes": "⊗", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "vert": "|", "Vert": "‖",
+	"{": "{", "}": "}", "|": "‖",
+}
+
+// texLargeOperators take their limits above and below in display mode.
+var texLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+	"bigcup": "⋃", "bigcap": "⋂",
+}
+
+var texFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true, "arcsin": true,
+	"arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true, "log": true,
+	"ln": true, "lg": true, "exp": true, "det": true, "dim": true, "ker": true, "deg": true,
+	"gcd": true, "arg": true, "max": true, "min": true, "sup": true, "inf": true, "lim": true,
+	"limsup": true, "liminf": true, "Pr": true,
+}
+
+var texAccents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "¯", "vec": "→", "overrightarrow": "→",
+	"dot": "˙", "ddot": "¨", "tilde": "~", "widetilde": "~", "check": "ˇ", "breve": "˘",
+}
+
+var texFonts = map[string]string{
+	"mathrm": "normal", "mathbf": "bold", "mathit": "italic", "mathbb": "double-struck",
+	"mathcal": "script", "mathfrak": "fraktur", "mathsf": "sans-serif", "mathtt": "monospace",
+	"boldsymbol": "bold-italic",
+}
+
+var texSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", "quad": "1em",
+	"qquad": "2em", "!": "-0.1667em", " ": "0.3333em",
+}
+
+var texEnvironments = map[string][2]string{
+	"matrix": {"", ""}, "pmatrix": {"(", ")"}, "bmatrix": {"[", "]"}, "Bmatrix": {"{", "}"},
+	"vmatrix": {"|", "|"}, "Vmatrix": {"‖", "‖"}, "cases": {"{", ""}, "aligned": {"", ""},
+	"array": {"", ""},
+}
+
+// texAlphabets hold where the letters and digits of each font start in the
+// Unicode mathematical alphanumeric symbols.
+var texAlphabets = map[string][3]rune{
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"italic":        {0x1D434, 0x1D44E, 0},
+	"bold-italic":   {0x1D468, 0x1D482, 0},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+	"fraktur":       {0x1D504, 0x1D51E, 0},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"sans-serif":    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	"monospace":     {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// texAlphabetHoles are the letters encoded before the rest of their font,
+// elsewhere.
+var texAlphabetHoles = map[string]map[rune]rune{
+	"italic": {'h': 'ℎ'},
+	"script": {'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ',
+		'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'},
+	"fraktur":       {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+	"double-struck": {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+}
+
+// styled returns the character in the font, or itself if the font has none.
+func styled(r rune, font string) rune {
+	if hole, ok := texAlphabetHoles[font][r]; ok {
+		return hole
+	}
+	start, ok := texAlphabets[font]
+	switch {
+	case !ok:
+		return r
+	case 'A' <= r && r <= 'Z':
+		return start[0] + r - 'A'
+	case 'a' <= r && r <= 'z':
+		return start[1] + r - 'a'
+	case '0' <= r && r <= '9' && start[2] != 0:
+		return start[2] + r - '0'
+	}
+	return r
+}
+
+type texParser struct {
+	src     string
+	pos     int
+	display bool
+	// font is the font of letters and digits within a font command
+	font string
+}
+
+// token returns the next token without consuming it: a command with its
+// backslash, or a single character. Spaces are skipped.
+func (p *texParser) token() (string, int) {
+	i := p.pos
+	for i < len(p.src) && (p.src[i] == ' ' || p.src[i] == '\n' || p.src[i] == '\t' || p.src[i] == '\r') {
+		i++
+	}
+	if i >= len(p.src) {
+		return "", i
+	}
+
+	if p.src[i] == '\\' {
+		j := i + 1
+		for j < len(p.src) && ('a' <= p.src[j] && p.src[j] <= 'z' || 'A' <= p.src[j] && p.src[j] <= 'Z') {
+			j++
+		}
+		if j == i+1 && j < len(p.src) {
+			_, size := utf8.DecodeRuneInString(p.src[j:])
+			j += size
+		}
+		return p.src[i:j], j
+	}
+
+	_, size := utf8.DecodeRuneInString(p.src[i:])
+	return p.src[i : i+size], i + size
+}
+
+func (p *texParser) next() string {
+	tok, end := p.token()
+	p.pos = end
+	return tok
+}
+
+func (p *texParser) peek() string {
+	tok, _ := p.token()
+	return tok
+}
+
+// parseList parses atoms up to the end of the source, a token closing a
+// group or an environment cell, or the extra token, which is not consumed.
+func (p *texParser) parseList(extra string) ([]string, error) {
+	var nodes []string
+	for {
+		switch tok := p.peek(); tok {
+		case "", "}", `\right`, `\end`, "&", `\\`, extra:
+			return nodes, nil
+		}
+
+		node, err := p.parseScripted()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+}
+
+// parseUntil parses atoms up to the closing token, which is consumed.
+func (p *texParser) parseUntil(closing string) ([]string, error) {
+	nodes, err := p.parseList(closing)
+	if err != nil {
+		return nil, err
+	}
+	if p.next() != closing {
+		return nil, errUnbalanced
+	}
+	return nodes, nil
+}
+
+// parseScripted parses an atom and the sub- and superscripts that follow.
+func (p *texParser) parseScripted() (string, error) {
+	tok := p.peek()
+	base, err := p.parseAtom()
+	if err != nil {
+		return "", err
+	}
+
+	var sub, sup string
+	for {
+		switch p.peek() {
+		case "_":
+			p.next()
+			sub, err = p.parseArgument()
+		case "^":
+			p.next()
+			sup, err = p.parseArgument()
+		case "'":
+			p.next()
+			sup += "<mo>′</mo>"
+			continue
+		default:
+			return mathScripts(base, sub, sup, p.display && isLimitOperator(tok)), nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+func isLimitOperator(tok string) bool {
+	name := strings.TrimPrefix(tok, `\`)
+	_, large := texLargeOperators[name]
+	return large && !strings.Contains(name, "int") ||
+		name == "lim" || name == "max" || name == "min" || name == "sup" || name == "inf"
+}
+
+func mathScripts(base, sub, sup string, limits bool) string {
+	under, over, both := "msub", "msup", "msubsup"
+	if limits {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sub != "" && sup != "":
+		return fmt.Sprintf("<%s>%s%s%s</%s>", both, base, sub, sup, both)
+	case sub != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", under, base, sub, under)
+	case sup != "":
+		return fmt.Sprintf("<%s>%s%s</%s>", over, base, sup, over)
+	}
+	return base
+}
+
+// parseArgument parses a group in braces or a single atom, as taken by
+// commands and scripts. Like TeX it takes a single digit of a number, so
+// \frac12 is a half.
+func (p *texParser) parseArgument() (string, error) {
+	if tok := p.peek(); isDigit(tok) {
+		p.next()
+		return "<mn>" + p.style(tok) + "</mn>", nil
+	}
+	if p.peek() == "{" {
+		p.next()
+		nodes, err := p.parseUntil("}")
+		if err != nil {
+			return "", err
+		}
+		return mathRow(nodes), nil
+	}
+	if p.peek() == "" {
+		return "", errUnbalanced
+	}
+	return p.parseAtom()
+}
+
+// rawArgument returns the source of a group in braces unparsed.
+func (p *texParser) rawArgument() (string, error) {
+	if p.next() != "{" {
+		return "", errUnbalanced
+	}
+	depth, start := 1, p.pos
+	for i := p.pos; i < len(p.src); i++ {
+		switch p.src[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.pos = i + 1
+				return p.src[start:i], nil
+			}
+		}
+	}
+	return "", errUnbalanced
+}
+
+func (p *texParser) parseAtom() (string, error) {
+	tok := p.next()
+	switch {
+	case tok == "{":
+		nodes, err := p.parseUntil("}")
+		if err != nil {
+			return "", err
+		}
+		return mathRow(nodes), nil
+	case tok == "}":
+		return "", errUnbalanced
+	case strings.HasPrefix(tok, `\`) && len(tok) > 1:
+		return p.parseCommand(tok[1:])
+	case isDigit(tok):
+		start := p.pos - 1
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos:p.pos+1]) ||
+			p.src[p.pos] == '.' && p.pos+1 < len(p.src) && isDigit(p.src[p.pos+1:p.pos+2])) {
+			p.pos++
+		}
+		return "<mn>" + p.style(p.src[start:p.pos]) + "</mn>", nil
+	case isLetter(tok):
+		if p.font == "normal" {
+			return `<mi mathvariant="normal">` + html.EscapeString(tok) + "</mi>", nil
+		}
+		return "<mi>" + html.EscapeString(p.style(tok)) + "</mi>", nil
+	case tok == "-":
+		return "<mo>−</mo>", nil
+	case tok == "*":
+		return "<mo>∗</mo>", nil
+	case tok == "~":
+		return `<mspace width="0.3333em"></mspace>`, nil
+	}
+	return "<mo>" + html.EscapeString(tok) + "</mo>", nil
+}
+
+func (p *texParser) parseCommand(name string) (string, error) {
+	if s, ok := texGreek[name]; ok {
+		if unicode.IsUpper([]rune(name)[0]) {
+			return `<mi mathvariant="normal">` + s + "</mi>", nil
+		}
+		return "<mi>" + s + "</mi>", nil
+	}
+	if s, ok := texSymbols[name]; ok {
+		return "<mi>" + s + "</mi>", nil
+	}
+	if s, ok := texOperators[name]; ok {
+		return "<mo>" + html.EscapeString(s) + "</mo>", nil
+	}
+	if s, ok := texLargeOperators[name]; ok {
+		return "<mo>" + s + "</mo>", nil
+	}
+	if texFunctions[name] {
+		return "<mi>" + name + "</mi>", nil
+	}
+	if width, ok := texSpaces[name]; ok {
+		return `<mspace width="` + width + `"></mspace>`, nil
+	}
+	if accent, ok := texAccents[name]; ok {
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		return `<mover accent="true">` + arg + `<mo stretchy="true">` + accent + "</mo></mover>", nil
+	}
+	if font, ok := texFonts[name]; ok {
+		outer := p.font
+		p.font = font
+		arg, err := p.parseArgument()
+		p.font = outer
+		return arg, err
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "binom":
+		num, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		den, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		if name == "binom" {
+			return `<mrow><mo>(</mo><mfrac linethickness="0">` + num + den + "</mfrac><mo>)</mo></mrow>", nil
+		}
+		return "<mfrac>" + num + den + "</mfrac>", nil
+	case "sqrt":
+		var index string
+		if p.peek() == "[" {
+			p.next()
+			nodes, err := p.parseUntil("]")
+			if err != nil {
+				return "", err
+			}
+			index = mathRow(nodes)
+		}
+		arg, err := p.parseArgument()
+		if err != nil {
+			return "", err
+		}
+		if index != "" {
+			return "<mroot>" + arg + index + "</mroot>", nil
+		}
+		return "<msqrt>" + arg + "</msqrt>", nil
+	case "text", "textrm", "mbox", "operatorname":
+		text, err := p.rawArgument()
+		if err != nil {
+			return "", err
+		}
+		if name == "operatorname" {
+			return "<mi>" + html.EscapeString(text) + "</mi>", nil
+		}
+		return "<mtext>" + html.EscapeString(text) + "</mtext>", nil
+	case "left":
+		open := p.delimiter()
+		nodes, err := p.parseUntil(`\right`)
+		if err != nil {
+			return "", err
+		}
+		close := p.delimiter()
+		return "<mrow>" + mathFence(open) + strings.Join(nodes, "") + mathFence(close) + "</mrow>", nil
+	case "begin":
+		return p.parseEnvironment()
+	}
+
+	return "<merror><mtext>" + html.EscapeString(`\`+name) + "</mtext></merror>", nil
+}
+
+// delimiter reads the delimiter after \left or \right, "." standing for
+// none.
+func (p *texParser) delimiter() string {
+	tok := p.next()
+	if s, ok := texOperators[strings.TrimPrefix(tok, `\`)]; ok && strings.HasPrefix(tok, `\`) {
+		return s
+	}
+	if tok == "." {
+		return ""
+	}
+	return tok
+}
+
+func mathFence(delim string) string {
+	if delim == "" {
+		return ""
+	}
+	return `<mo fence="true" stretchy="true">` + html.EscapeString(delim) + "</mo>"
+}
+
+func (p *texParser) parseEnvironment() (string, error) {
+	name, err := p.rawArgument()
+	if err != nil {
+		return "", err
+	}
+	delims, ok := texEnvironments[name]
+	if !ok {
+		return "<merror><mtext>" + html.EscapeString(name) + "</mtext></merror>", nil
+	}
+	if name == "array" {
+		// the column alignment is left to the defaults
+		if _, err = p.rawArgument(); err != nil {
+			return "", err
+		}
+	}
+
+	var rows []string
+	var cells []string
+	for {
+		nodes, err := p.parseList("")
+		if err != nil {
+			return "", err
+		}
+		cells = append(cells, "<mtd>"+mathRow(nodes)+"</mtd>")
+
+		switch p.next() {
+		case "&":
+			continue
+		case `\\`:
+			rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+			cells = nil
+			continue
+		case `\end`:
+			if end, err := p.rawArgument(); err != nil || end != name {
+				return "", errUnbalanced
+			}
+		default:
+			return "", errUnbalanced
+		}
+		break
+	}
+	if len(cells) > 1 || len(cells) == 1 && cells[0] != "<mtd><mrow></mrow></mtd>" {
+		rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+	}
+
+	table := "<mtable>" + strings.Join(rows, "") + "</mtable>"
+	return "<mrow>" + mathFence(delims[0]) + table + mathFence(delims[1]) + "</mrow>", nil
+}
+
+func (p *texParser) style(s string) string {
+	if p.font == "" || p.font == "normal" {
+		return s
+	}
+	return strings.Map(func(r rune) rune { return styled(r, p.font) }, s)
+}
+
+func mathRow(nodes []string) string {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	return "<mrow>" + strings.Join(nodes, "") + "</mrow>"
+}
+
+func isDigit(s string) bool {
+	return len(s) == 1 && '0' <= s[0] && s[0] <= '9'
+}
+
+func isLetter(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLetter(r)
+}
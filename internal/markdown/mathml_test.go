@@ -0,0 +1,93 @@
+package markdown
+
+import (
+	"html"
+	"strings"
+	"testing"
+)
+
+func TestTexToMathML(t *testing.T) {
+	tests := []struct {
+		name    string
+		tex     string
+		display bool
+		want    string
+	}{
+		{"fraction", `\frac{a}{b}`, false, `<mfrac><mi>a</mi><mi>b</mi></mfrac>`},
+		{"fraction of digits", `\frac12`, false, `<mfrac><mn>1</mn><mn>2</mn></mfrac>`},
+		{"binomial", `\binom{n}{k}`, false,
+			`<mrow><mo>(</mo><mfrac linethickness="0"><mi>n</mi><mi>k</mi></mfrac><mo>)</mo></mrow>`},
+		{"subscript", `x_i`, false, `<msub><mi>x</mi><mi>i</mi></msub>`},
+		{"superscript", `x^2`, false, `<msup><mi>x</mi><mn>2</mn></msup>`},
+		{"superscript of a digit", `x^23`, false, `<mrow><msup><mi>x</mi><mn>2</mn></msup><mn>3</mn></mrow>`},
+		{"both scripts", `x_i^{n+1}`, false,
+			`<msubsup><mi>x</mi><mi>i</mi><mrow><mi>n</mi><mo>+</mo><mn>1</mn></mrow></msubsup>`},
+		{"prime", `f'`, false, `<msup><mi>f</mi><mo>′</mo></msup>`},
+		{"inline limits", `\sum_{i=1}^n`, false,
+			`<msubsup><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></msubsup>`},
+		{"display limits", `\sum_{i=1}^n`, true,
+			`<munderover><mo>∑</mo><mrow><mi>i</mi><mo>=</mo><mn>1</mn></mrow><mi>n</mi></munderover>`},
+		{"integral keeps scripts", `\int_0^1`, true, `<msubsup><mo>∫</mo><mn>0</mn><mn>1</mn></msubsup>`},
+		{"square root", `\sqrt{x}`, false, `<msqrt><mi>x</mi></msqrt>`},
+		{"root", `\sqrt[3]{x}`, false, `<mroot><mi>x</mi><mn>3</mn></mroot>`},
+		{"matrix", `\begin{pmatrix}a & b\\ c & d\end{pmatrix}`, true,
+			`<mrow><mo fence="true" stretchy="true">(</mo><mtable>` +
+				`<mtr><mtd><mi>a</mi></mtd><mtd><mi>b</mi></mtd></mtr>` +
+				`<mtr><mtd><mi>c</mi></mtd><mtd><mi>d</mi></mtd></mtr>` +
+				`</mtable><mo fence="true" stretchy="true">)</mo></mrow>`},
+		{"matrix with a trailing row break", `\begin{matrix}1\\\end{matrix}`, true,
+			`<mrow><mtable><mtr><mtd><mn>1</mn></mtd></mtr></mtable></mrow>`},
+		{"cases", `\begin{cases}0 & x<0\\1\end{cases}`, true,
+			`<mrow><mo fence="true" stretchy="true">{</mo><mtable>` +
+				`<mtr><mtd><mn>0</mn></mtd><mtd><mrow><mi>x</mi><mo>&lt;</mo><mn>0</mn></mrow></mtd></mtr>` +
+				`<mtr><mtd><mn>1</mn></mtd></mtr></mtable></mrow>`},
+		{"unknown command", `\foo`, false, `<merror><mtext>\foo</mtext></merror>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := texToMathML(tt.tex, tt.display)
+			if err != nil {
+				t.Fatalf("texToMathML(%q) failed: %v", tt.tex, err)
+			}
+			mode := "inline"
+			if tt.display {
+				mode = "block"
+			}
+			want := `<math xmlns="http://www.w3.org/1998/Math/MathML" display="` + mode + `"><semantics>` +
+				tt.want + `<annotation encoding="application/x-tex">` + html.EscapeString(tt.tex) +
+				`</annotation></semantics></math>`
+			if got != want {
+				t.Errorf("texToMathML(%q)\ngot:  %s\nwant: %s", tt.tex, got, want)
+			}
+		})
+	}
+}
+
+func TestTexToMathMLErrors(t *testing.T) {
+	for _, tex := range []string{`{a`, `a}`, `\frac{a}`, `x^`, `\sqrt[3{x}`, `\left(x`,
+		`\begin{matrix}a\end{pmatrix}`, `\begin{matrix}a`, `\text{a`} {
+		if got, err := texToMathML(tex, false); err == nil {
+			t.Errorf("texToMathML(%q) = %s, want an error", tex, got)
+		}
+	}
+}
+
+func TestWriteMathFallback(t *testing.T) {
+	tests := []struct {
+		tex     string
+		display bool
+		want    string
+	}{
+		{`\frac{a}{<b>`, false, `<code>\frac{a}{&lt;b&gt;</code>`},
+		{"\n\\frac{a}{<b>\n", true, "<pre><code>\\frac{a}{&lt;b&gt;</code></pre>\n"},
+	}
+
+	for _, tt := range tests {
+		var b strings.Builder
+		writeMath(&b, []byte(tt.tex), tt.display)
+		if b.String() != tt.want {
+			t.Errorf("writeMath(%q, %v) = %q, want %q", tt.tex, tt.display, b.String(), tt.want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"github.com/microcosm-cc/bluemonday"
+	"regexp"
+	"strings"
+)
+
+// basePolicy returns the policy of bluemonday for content of users, with
+// tables only if they are allowed and without the nofollow it puts on every
+// link, external links get theirs after sanitising.
+func basePolicy(tables bool) *bluemonday.Policy {
+	p := bluemonday.NewPolicy()
+
+	p.AllowStandardAttributes()
+	p.AllowStandardURLs()
+
+	p.AllowElements("article", "aside", "figure", "section", "summary", "hgroup")
+	p.AllowAttrs("open").Matching(regexp.MustCompile(`(?i)^(|open)$`)).OnElements("details")
+	p.AllowElements("h1", "h2", "h3", "h4", "h5", "h6")
+
+	p.AllowAttrs("cite").OnElements("blockquote")
+	p.AllowElements("br", "div", "hr", "p", "span", "wbr")
+
+	p.AllowAttrs("href").OnElements("a")
+
+	p.AllowElements("abbr", "acronym", "cite", "code", "dfn", "em",
+		"figcaption", "mark", "s", "samp", "strong", "sub", "sup", "var")
+	p.AllowAttrs("cite").OnElements("q")
+	p.AllowAttrs("datetime").Matching(bluemonday.ISO8601).OnElements("time")
+
+	p.AllowElements("b", "i", "pre", "small", "strike", "tt", "u")
+
+	p.AllowAttrs("dir").Matching(bluemonday.Direction).OnElements("bdi", "bdo")
+	p.AllowElements("rp", "rt", "ruby")
+
+	p.AllowAttrs("cite").Matching(bluemonday.Paragraph).OnElements("del", "ins")
+	p.AllowAttrs("datetime").Matching(bluemonday.ISO8601).OnElements("del", "ins")
+
+	p.AllowLists()
+	if tables {
+		p.AllowTables()
+	}
+
+	p.AllowImages()
+
+	// AllowStandardURLs, which AllowImages calls too, requires it
+	p.RequireNoFollowOnLinks(false)
+
+	return p
+}
+
+// allowFrames lets through iframes of pages on the hosts the publication
+// listed, sandboxed so that they can't reach the page around them. Writers
+// may allow scripts, popups and presentation in the sandbox, but never
+// allow-same-origin: with scripts it lets a page of the site's own origin
+// take its sandbox off.
+func allowFrames(policy *bluemonday.Policy, opts Options) {
+	if len(opts.FrameHosts) == 0 {
+		return
+	}
+
+	hosts := make([]string, len(opts.FrameHosts))
+	for i, host := range opts.FrameHosts {
+		hosts[i] = regexp.QuoteMeta(host)
+	}
+	src := regexp.MustCompile(`^https://(` + strings.Join(hosts, "|") + `)/`)
+
+	policy.AllowAttrs("src").Matching(src).OnElements("iframe")
+	policy.AllowAttrs("width", "height").Matching(bluemonday.NumberOrPercent).OnElements("iframe")
+	policy.AllowAttrs("title").Matching(bluemonday.Paragraph).OnElements("iframe")
+	policy.AllowAttrs("allowfullscreen").Matching(regexp.MustCompile(`(?i)^(|allowfullscreen)$`)).
+		OnElements("iframe")
+	policy.AllowAttrs("sandbox").OnElements("iframe")
+	policy.AllowIFrames(bluemonday.SandboxAllowScripts, bluemonday.SandboxAllowPopups,
+		bluemonday.SandboxAllowPresentation)
+}
@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFS(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, "ab/cd"); err != ErrNotFound {
+		t.Errorf("Get of a missing blob = %v, want ErrNotFound", err)
+	}
+
+	err = s.Put(ctx, "ab/cd", []byte("first"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.Put(ctx, "ab/cd", []byte("second"), "text/plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, "ab/cd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "second" {
+		t.Errorf("Get = %q, want %q", got, "second")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "blobs", "ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "cd" {
+		t.Errorf("the directory holds %v, want only the blob", entries)
+	}
+
+	err = s.Delete(ctx, "ab/cd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, "ab/cd"); err != ErrNotFound {
+		t.Errorf("Get of a deleted blob = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "ab/cd"); err != nil {
+		t.Errorf("Delete of a missing blob = %v, want nil", err)
+	}
+}
+
+// TestFSFailedPut checks that a put failing at the rename leaves neither the
+// temporary file nor a partial blob behind.
+func TestFSFailedPut(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	s, err := NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a non empty directory can't be replaced by a file
+	err = os.MkdirAll(filepath.Join(dir, "ab", "cd", "ef"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(ctx, "ab/cd", []byte("blob"), "text/plain"); err == nil {
+		t.Fatal("Put over a directory succeeded")
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, "ab"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "cd" || !entries[0].IsDir() {
+		t.Errorf("the directory holds %v, want only the existing one", entries)
+	}
+}
+
+func TestFSInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/ab", "ab/", "ab//cd", "../ab", "ab/../../cd", `ab\cd`} {
+		if err := s.Put(ctx, key, []byte("blob"), "text/plain"); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+		if _, err := s.Get(ctx, key); err == nil || err == ErrNotFound {
+			t.Errorf("Get(%q) = %v, want an invalid key error", key, err)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// s3StandIn is an in memory bucket checking the signature of every request
+// the way S3 does, rejecting the ones it can't verify with 403.
+type s3StandIn struct {
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func (s *s3StandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := s.verify(r, body); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + s.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		s.objects[key] = body
+		s.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		data, ok := s.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case http.MethodDelete:
+		delete(s.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "MethodNotAllowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// verify recomputes the Signature Version 4 of the request from the headers
+// it names as signed.
+func (s *s3StandIn) verify(r *http.Request, body []byte) error {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+		return fmt.Errorf("unsigned request")
+	}
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		name, value, _ := strings.Cut(field, "=")
+		fields[name] = value
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	when, err := time.Parse("20060102T150405Z", amzDate)
+	if err != nil {
+		return fmt.Errorf("invalid x-amz-date %q", amzDate)
+	}
+	if d := time.Since(when); d < -time.Minute || d > 15*time.Minute {
+		return fmt.Errorf("x-amz-date %q is out of range", amzDate)
+	}
+
+	scope := when.Format("20060102") + "/" + s.region + "/s3/aws4_request"
+	if fields["Credential"] != s.accessKey+"/"+scope {
+		return fmt.Errorf("invalid credential %q", fields["Credential"])
+	}
+
+	payloadHash := r.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash != sha256Hex(body) {
+		return fmt.Errorf("x-amz-content-sha256 doesn't match the payload")
+	}
+
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		return fmt.Errorf("signed headers aren't sorted")
+	}
+	required := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if r.Header.Get("Content-Type") != "" {
+		required = append(required, "content-type")
+	}
+	for _, name := range required {
+		if !contains(signed, name) {
+			return fmt.Errorf("%s isn't signed", name)
+		}
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	key := []byte("AWS4" + s.secretKey)
+	for _, part := range []string{when.Format("20060102"), s.region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	want := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	if !hmac.Equal([]byte(fields["Signature"]), []byte(want)) {
+		return fmt.Errorf("SignatureDoesNotMatch")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func newS3StandIn(t *testing.T) (*s3StandIn, S3Config) {
+	standIn := &s3StandIn{
+		bucket:    "blobs",
+		region:    "eu-west-1",
+		accessKey: "access",
+		secretKey: "secret",
+		objects:   map[string][]byte{},
+		types:     map[string]string{},
+	}
+	server := httptest.NewServer(standIn)
+	t.Cleanup(server.Close)
+
+	return standIn, S3Config{
+		Endpoint:  server.URL,
+		Region:    standIn.region,
+		Bucket:    standIn.bucket,
+		AccessKey: standIn.accessKey,
+		SecretKey: standIn.secretKey,
+	}
+}
+
+func TestS3(t *testing.T) {
+	ctx := context.Background()
+	standIn, cfg := newS3StandIn(t)
+
+	s, err := NewS3(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the key needs escaping in the canonical path
+	key := "ab/c d+e=f"
+
+	if _, err := s.Get(ctx, key); err != ErrNotFound {
+		t.Errorf("Get of a missing object = %v, want ErrNotFound", err)
+	}
+
+	err = s.Put(ctx, key, []byte("blob"), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := standIn.types[key]; got != "image/png" {
+		t.Errorf("stored content type = %q, want %q", got, "image/png")
+	}
+
+	got, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "blob" {
+		t.Errorf("Get = %q, want %q", got, "blob")
+	}
+
+	err = s.Delete(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Get(ctx, key); err != ErrNotFound {
+		t.Errorf("Get of a deleted object = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing object = %v, want nil", err)
+	}
+}
+
+func TestS3WrongSecret(t *testing.T) {
+	ctx := context.Background()
+	_, cfg := newS3StandIn(t)
+	cfg.SecretKey = "wrong"
+
+	s, err := NewS3(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = s.Put(ctx, "ab/cd", []byte("blob"), "image/png")
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Put with a wrong secret = %v, want a 403 error", err)
+	}
+	if _, err := s.Get(ctx, "ab/cd"); err == nil || err == ErrNotFound {
+		t.Errorf("Get with a wrong secret = %v, want a 403 error", err)
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	for _, cfg := range []S3Config{
+		{Endpoint: "localhost:9000", Bucket: "blobs"},
+		{Endpoint: "http://localhost:9000"},
+	} {
+		if _, err := NewS3(cfg); err == nil {
+			t.Errorf("NewS3(%+v) succeeded", cfg)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// Store keeps blobs under slash separated keys. Blobs are never changed once
+// stored, putting a blob under a key that is taken replaces it with the same
+// content.
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Config selects and configures the backend of a store.
+type Config struct {
+	// Backend is either "fs" or "s3".
+	Backend string
+	// Dir is the directory of the fs backend.
+	Dir string
+	S3  S3Config
+}
+
+// Open returns the store described by the config.
+func Open(cfg Config) (Store, error) {
+	switch cfg.Backend {
+	case "fs":
+		return NewFS(cfg.Dir)
+	case "s3":
+		return NewS3(cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
+	}
+}
+
+// validKey reports whether the key is made of non empty path segments that
+// don't lead out of the store.
+func validKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.Contains(segment, `\`) {
+			return false
+		}
+	}
+	return true
+}
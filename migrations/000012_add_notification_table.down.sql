@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS notification_unread_idx;
+DROP INDEX IF EXISTS notification_user_id_idx;
+
+DROP TABLE IF EXISTS notification_preference;
+DROP TABLE IF EXISTS notification;
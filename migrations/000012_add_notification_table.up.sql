@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS notification
+(
+    id             bigserial PRIMARY KEY,
+    created_at     timestamp(0) with time zone NOT NULL DEFAULT now(),
+    user_id        int                         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    actor_id       int                         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    type           text                        NOT NULL,
+    publication_id int REFERENCES publication (id) ON DELETE CASCADE,
+    article_id     int REFERENCES article (id) ON DELETE CASCADE,
+    comment_id     int REFERENCES comment (id) ON DELETE CASCADE,
+    read_at        timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS notification_user_id_idx ON notification (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS notification_unread_idx ON notification (user_id) WHERE read_at IS NULL;
+
+CREATE TABLE IF NOT EXISTS notification_preference
+(
+    user_id int REFERENCES users (id) ON DELETE CASCADE,
+    type    text    NOT NULL,
+    enabled boolean NOT NULL DEFAULT true,
+    CONSTRAINT notification_preference_pk
+        PRIMARY KEY (user_id, type)
+);
@@ -0,0 +1,14 @@
+DROP TRIGGER IF EXISTS notification_notify
+    ON notification;
+DROP TRIGGER IF EXISTS comment_notify
+    ON comment;
+DROP TRIGGER IF EXISTS comment_like_notify
+    ON comment_like;
+DROP TRIGGER IF EXISTS article_like_notify
+    ON article_like;
+
+DROP FUNCTION IF EXISTS notify_notification;
+DROP FUNCTION IF EXISTS notify_comment;
+DROP FUNCTION IF EXISTS notify_comment_like;
+DROP FUNCTION IF EXISTS notify_article_like;
+DROP FUNCTION IF EXISTS notify_event;
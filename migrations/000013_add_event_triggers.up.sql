@@ -0,0 +1,109 @@
+CREATE OR REPLACE FUNCTION notify_event(topic text, event text, data json)
+    RETURNS void AS
+$BODY$
+BEGIN
+    PERFORM pg_notify('events', json_build_object('topic', topic, 'event', event, 'data', data)::text);
+END;
+$BODY$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE FUNCTION notify_article_like()
+    RETURNS TRIGGER AS
+$BODY$
+DECLARE
+    aid int;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        aid := OLD.article_id;
+    ELSE
+        aid := NEW.article_id;
+    END IF;
+
+    PERFORM notify_event('article:' || aid, 'like',
+                         json_build_object('count', (SELECT count(*) FROM article_like WHERE article_id = aid)));
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS article_like_notify
+    ON article_like;
+
+CREATE TRIGGER article_like_notify
+    AFTER INSERT OR DELETE
+    ON article_like
+    FOR EACH ROW
+EXECUTE FUNCTION notify_article_like();
+
+CREATE OR REPLACE FUNCTION notify_comment_like()
+    RETURNS TRIGGER AS
+$BODY$
+DECLARE
+    cid int;
+    aid int;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        cid := OLD.comment_id;
+    ELSE
+        cid := NEW.comment_id;
+    END IF;
+
+    -- the comment is already gone when its likes are cascaded away
+    SELECT article_id INTO aid FROM comment WHERE id = cid;
+    IF aid IS NOT NULL THEN
+        PERFORM notify_event('article:' || aid, 'comment-like',
+                             json_build_object('id', cid,
+                                               'count', (SELECT count(*) FROM comment_like WHERE comment_id = cid)));
+    END IF;
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comment_like_notify
+    ON comment_like;
+
+CREATE TRIGGER comment_like_notify
+    AFTER INSERT OR DELETE
+    ON comment_like
+    FOR EACH ROW
+EXECUTE FUNCTION notify_comment_like();
+
+CREATE OR REPLACE FUNCTION notify_comment()
+    RETURNS TRIGGER AS
+$BODY$
+BEGIN
+    PERFORM notify_event('article:' || NEW.article_id, 'comment', json_build_object('id', NEW.id));
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comment_notify
+    ON comment;
+
+CREATE TRIGGER comment_notify
+    AFTER INSERT
+    ON comment
+    FOR EACH ROW
+EXECUTE FUNCTION notify_comment();
+
+CREATE OR REPLACE FUNCTION notify_notification()
+    RETURNS TRIGGER AS
+$BODY$
+BEGIN
+    -- identical payloads within a transaction are delivered only once, so
+    -- marking many notifications read at once sends a single event
+    PERFORM notify_event('user:' || NEW.user_id, 'notification',
+                         json_build_object('unread', (SELECT count(*)
+                                                      FROM notification
+                                                      WHERE user_id = NEW.user_id
+                                                        AND read_at IS NULL)));
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS notification_notify
+    ON notification;
+
+CREATE TRIGGER notification_notify
+    AFTER INSERT OR UPDATE OF read_at
+    ON notification
+    FOR EACH ROW
+EXECUTE FUNCTION notify_notification();
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS reading_list_user_id_idx;
+
+DROP TABLE IF EXISTS reading_list_article;
+DROP TABLE IF EXISTS reading_list;
+DROP TABLE IF EXISTS bookmark;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS bookmark
+(
+    user_id    int REFERENCES users (id) ON DELETE CASCADE,
+    article_id int REFERENCES article (id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT bookmark_pk
+        PRIMARY KEY (user_id, article_id)
+);
+
+CREATE TABLE IF NOT EXISTS reading_list
+(
+    id         bigserial PRIMARY KEY,
+    user_id    int                         NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name       text                        NOT NULL,
+    public     boolean                     NOT NULL DEFAULT false,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    version    int                         NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS reading_list_article
+(
+    reading_list_id int REFERENCES reading_list (id) ON DELETE CASCADE,
+    article_id      int REFERENCES article (id) ON DELETE CASCADE,
+    created_at      timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT reading_list_article_pk
+        PRIMARY KEY (reading_list_id, article_id)
+);
+
+CREATE INDEX IF NOT EXISTS reading_list_user_id_idx ON reading_list (user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS follows_followee_id_idx;
+
+DROP TABLE IF EXISTS follows;
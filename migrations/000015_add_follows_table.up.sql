@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS follows
+(
+    follower_id int REFERENCES users (id) ON DELETE CASCADE,
+    followee_id int REFERENCES users (id) ON DELETE CASCADE,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT follows_pk
+        PRIMARY KEY (follower_id, followee_id),
+    CONSTRAINT follows_self_check
+        CHECK (follower_id <> followee_id)
+);
+
+CREATE INDEX IF NOT EXISTS follows_followee_id_idx ON follows (followee_id);
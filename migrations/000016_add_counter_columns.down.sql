@@ -0,0 +1,20 @@
+DROP TRIGGER IF EXISTS comment_count
+    ON comment;
+DROP TRIGGER IF EXISTS comment_like_count
+    ON comment_like;
+DROP TRIGGER IF EXISTS article_like_count
+    ON article_like;
+
+DROP FUNCTION IF EXISTS count_comment;
+DROP FUNCTION IF EXISTS count_comment_like;
+DROP FUNCTION IF EXISTS count_article_like;
+
+DROP INDEX IF EXISTS article_created_at_idx;
+DROP INDEX IF EXISTS article_likes_idx;
+
+ALTER TABLE comment
+    DROP COLUMN IF EXISTS likes;
+
+ALTER TABLE article
+    DROP COLUMN IF EXISTS comments,
+    DROP COLUMN IF EXISTS likes;
@@ -0,0 +1,84 @@
+ALTER TABLE article
+    ADD COLUMN IF NOT EXISTS likes    int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS comments int NOT NULL DEFAULT 0;
+
+ALTER TABLE comment
+    ADD COLUMN IF NOT EXISTS likes int NOT NULL DEFAULT 0;
+
+UPDATE article a
+SET likes    = (SELECT count(*) FROM article_like WHERE article_id = a.id),
+    comments = (SELECT count(*) FROM comment WHERE article_id = a.id);
+
+UPDATE comment c
+SET likes = (SELECT count(*) FROM comment_like WHERE comment_id = c.id);
+
+CREATE INDEX IF NOT EXISTS article_likes_idx ON article (likes DESC, id DESC);
+CREATE INDEX IF NOT EXISTS article_created_at_idx ON article (created_at DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION count_article_like()
+    RETURNS TRIGGER AS
+$BODY$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE article SET likes = likes - 1 WHERE id = OLD.article_id;
+    ELSE
+        UPDATE article SET likes = likes + 1 WHERE id = NEW.article_id;
+    END IF;
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+-- triggers fire in name order, so the counters are up to date by the time
+-- the *_notify triggers run
+DROP TRIGGER IF EXISTS article_like_count
+    ON article_like;
+
+CREATE TRIGGER article_like_count
+    AFTER INSERT OR DELETE
+    ON article_like
+    FOR EACH ROW
+EXECUTE FUNCTION count_article_like();
+
+CREATE OR REPLACE FUNCTION count_comment_like()
+    RETURNS TRIGGER AS
+$BODY$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE comment SET likes = likes - 1 WHERE id = OLD.comment_id;
+    ELSE
+        UPDATE comment SET likes = likes + 1 WHERE id = NEW.comment_id;
+    END IF;
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comment_like_count
+    ON comment_like;
+
+CREATE TRIGGER comment_like_count
+    AFTER INSERT OR DELETE
+    ON comment_like
+    FOR EACH ROW
+EXECUTE FUNCTION count_comment_like();
+
+CREATE OR REPLACE FUNCTION count_comment()
+    RETURNS TRIGGER AS
+$BODY$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE article SET comments = comments - 1 WHERE id = OLD.article_id;
+    ELSE
+        UPDATE article SET comments = comments + 1 WHERE id = NEW.article_id;
+    END IF;
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS comment_count
+    ON comment;
+
+CREATE TRIGGER comment_count
+    AFTER INSERT OR DELETE
+    ON comment
+    FOR EACH ROW
+EXECUTE FUNCTION count_comment();
@@ -0,0 +1,12 @@
+-- hot scores decay with age, so they are computed ahead of time and
+-- refreshed periodically instead of on every feed request
+CREATE MATERIALIZED VIEW IF NOT EXISTS article_trending AS
+SELECT id                                                                     AS article_id,
+       created_at,
+       likes / power(extract(epoch FROM now() - created_at) / 3600 + 2, 1.8) AS score
+FROM article
+WHERE likes > 0;
+
+-- REFRESH MATERIALIZED VIEW CONCURRENTLY needs a unique index
+CREATE UNIQUE INDEX IF NOT EXISTS article_trending_article_id_idx ON article_trending (article_id);
+CREATE INDEX IF NOT EXISTS article_trending_score_idx ON article_trending (score DESC, article_id DESC);
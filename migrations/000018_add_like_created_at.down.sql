@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS article_like_article_id_idx;
+
+ALTER TABLE comment_like
+    DROP COLUMN IF EXISTS created_at;
+
+ALTER TABLE article_like
+    DROP COLUMN IF EXISTS created_at;
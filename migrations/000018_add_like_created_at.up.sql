@@ -0,0 +1,7 @@
+ALTER TABLE article_like
+    ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT now();
+
+ALTER TABLE comment_like
+    ADD COLUMN IF NOT EXISTS created_at timestamp(0) with time zone NOT NULL DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS article_like_article_id_idx ON article_like (article_id);
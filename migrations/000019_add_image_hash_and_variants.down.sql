@@ -0,0 +1,8 @@
+DROP TABLE IF EXISTS image_variant;
+
+DROP INDEX IF EXISTS image_hash_idx;
+
+ALTER TABLE image
+    DROP COLUMN IF EXISTS created_at,
+    DROP COLUMN IF EXISTS content_type,
+    DROP COLUMN IF EXISTS hash;
@@ -0,0 +1,24 @@
+ALTER TABLE image
+    ADD COLUMN IF NOT EXISTS hash         text,
+    ADD COLUMN IF NOT EXISTS content_type text                        NOT NULL DEFAULT 'image/jpeg',
+    ADD COLUMN IF NOT EXISTS created_at   timestamp(0) with time zone NOT NULL DEFAULT now();
+
+UPDATE image
+SET hash = encode(sha256(image_data), 'hex')
+WHERE hash IS NULL;
+
+ALTER TABLE image
+    ALTER COLUMN hash SET NOT NULL;
+
+CREATE INDEX IF NOT EXISTS image_hash_idx ON image (hash);
+
+CREATE TABLE IF NOT EXISTS image_variant
+(
+    image_id     bigint REFERENCES image (id) ON DELETE CASCADE,
+    size         int                         NOT NULL,
+    content_type text                        NOT NULL,
+    image_data   bytea                       NOT NULL,
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT image_variant_pk
+        PRIMARY KEY (image_id, size, content_type)
+);
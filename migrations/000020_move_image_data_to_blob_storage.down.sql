@@ -0,0 +1,19 @@
+-- variants are generated again on demand, originals already moved to blob
+-- storage have no data to restore, so image_data stays nullable
+DELETE
+FROM image_variant
+WHERE image_data IS NULL;
+
+ALTER TABLE image_variant
+    DROP COLUMN IF EXISTS byte_size,
+    ALTER COLUMN image_data SET NOT NULL;
+
+ALTER TABLE image
+    DROP COLUMN IF EXISTS owner_id,
+    DROP COLUMN IF EXISTS byte_size,
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width;
+
+DROP INDEX IF EXISTS image_hash_key;
+
+CREATE INDEX IF NOT EXISTS image_hash_idx ON image (hash);
@@ -0,0 +1,35 @@
+-- point the users at one image of each content hash before dropping the
+-- duplicates, so that the hash can name a single blob
+UPDATE users u
+SET image_id = d.keep_id
+FROM (SELECT id, min(id) OVER (PARTITION BY hash) AS keep_id FROM image) d
+WHERE u.image_id = d.id
+  AND d.id <> d.keep_id;
+
+DELETE
+FROM image i
+    USING image k
+WHERE i.hash = k.hash
+  AND i.id > k.id;
+
+DROP INDEX IF EXISTS image_hash_idx;
+
+CREATE UNIQUE INDEX IF NOT EXISTS image_hash_key ON image (hash);
+
+ALTER TABLE image
+    ALTER COLUMN image_data DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS width     int    NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS height    int    NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS byte_size int    NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS owner_id  bigint REFERENCES users (id) ON DELETE SET NULL;
+
+UPDATE image i
+SET byte_size = length(i.image_data),
+    owner_id  = (SELECT min(u.id) FROM users u WHERE u.image_id = i.id);
+
+ALTER TABLE image_variant
+    ALTER COLUMN image_data DROP NOT NULL,
+    ADD COLUMN IF NOT EXISTS byte_size int NOT NULL DEFAULT 0;
+
+UPDATE image_variant
+SET byte_size = length(image_data);
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS publication_image
+(
+    publication_id bigint                      NOT NULL REFERENCES publication (id) ON DELETE CASCADE,
+    image_id       bigint                      NOT NULL REFERENCES image (id) ON DELETE CASCADE,
+    uploader_id    bigint REFERENCES users (id) ON DELETE SET NULL,
+    alt            text                        NOT NULL DEFAULT '',
+    created_at     timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT publication_image_pk
+        PRIMARY KEY (publication_id, image_id)
+);
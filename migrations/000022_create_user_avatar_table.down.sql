@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS users_image_id_idx;
+DROP INDEX IF EXISTS publication_image_image_id_idx;
+
+DROP TABLE IF EXISTS user_avatar;
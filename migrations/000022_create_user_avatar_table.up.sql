@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS user_avatar
+(
+    user_id    bigint                      NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    image_id   bigint                      NOT NULL REFERENCES image (id) ON DELETE CASCADE,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    CONSTRAINT user_avatar_pk
+        PRIMARY KEY (user_id, image_id)
+);
+
+INSERT INTO user_avatar (user_id, image_id)
+SELECT id, image_id
+FROM users
+WHERE image_id IS NOT NULL
+ON CONFLICT ON CONSTRAINT user_avatar_pk DO NOTHING;
+
+-- the image sweeper looks up the references of each image
+CREATE INDEX IF NOT EXISTS user_avatar_image_id_idx ON user_avatar (image_id);
+CREATE INDEX IF NOT EXISTS publication_image_image_id_idx ON publication_image (image_id);
+CREATE INDEX IF NOT EXISTS users_image_id_idx ON users (image_id);
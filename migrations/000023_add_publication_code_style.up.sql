@@ -0,0 +1 @@
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS code_style text NOT NULL DEFAULT 'github';
@@ -0,0 +1 @@
+ALTER TABLE publication DROP COLUMN IF EXISTS markdown_features;
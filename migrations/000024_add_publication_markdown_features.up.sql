@@ -0,0 +1 @@
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS markdown_features text[] NOT NULL DEFAULT '{}';
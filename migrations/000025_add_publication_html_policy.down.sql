@@ -0,0 +1,2 @@
+ALTER TABLE publication DROP COLUMN IF EXISTS frame_hosts;
+ALTER TABLE publication DROP COLUMN IF EXISTS allow_tables;
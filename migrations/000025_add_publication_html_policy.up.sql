@@ -0,0 +1,2 @@
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS allow_tables boolean NOT NULL DEFAULT true;
+ALTER TABLE publication ADD COLUMN IF NOT EXISTS frame_hosts text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,6 @@
+ALTER TABLE article
+    DROP COLUMN IF EXISTS reading_time,
+    DROP COLUMN IF EXISTS word_count,
+    DROP COLUMN IF EXISTS excerpt,
+    DROP COLUMN IF EXISTS cover,
+    DROP COLUMN IF EXISTS subtitle;
@@ -0,0 +1,13 @@
+ALTER TABLE article
+    ADD COLUMN IF NOT EXISTS subtitle     text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cover        text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS excerpt      text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS word_count   int  NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS reading_time int  NOT NULL DEFAULT 1;
+
+-- the counts of existing articles are of their raw Markdown; the excerpts,
+-- which need the Markdown stripped, are made from the content when read
+UPDATE article
+SET word_count   = coalesce(array_length(regexp_split_to_array(trim(content), '\s+'), 1), 0),
+    reading_time = greatest(1, ceil(coalesce(array_length(regexp_split_to_array(trim(content), '\s+'), 1), 0) / 200.0)),
+    cover        = coalesce(substring(content from '!\[[^]]*\]\(([^)\s]+)'), '');
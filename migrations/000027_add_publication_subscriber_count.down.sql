@@ -0,0 +1,9 @@
+DROP TRIGGER IF EXISTS subscriber_count
+    ON subscribes_to;
+
+DROP FUNCTION IF EXISTS count_subscriber;
+
+DROP INDEX IF EXISTS publication_subscribers_idx;
+
+ALTER TABLE publication
+    DROP COLUMN IF EXISTS subscribers;
@@ -0,0 +1,29 @@
+ALTER TABLE publication
+    ADD COLUMN IF NOT EXISTS subscribers int NOT NULL DEFAULT 0;
+
+UPDATE publication p
+SET subscribers = (SELECT count(*) FROM subscribes_to WHERE publication_id = p.id);
+
+CREATE INDEX IF NOT EXISTS publication_subscribers_idx ON publication (subscribers DESC, id DESC);
+
+CREATE OR REPLACE FUNCTION count_subscriber()
+    RETURNS TRIGGER AS
+$BODY$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        UPDATE publication SET subscribers = subscribers - 1 WHERE id = OLD.publication_id;
+    ELSE
+        UPDATE publication SET subscribers = subscribers + 1 WHERE id = NEW.publication_id;
+    END IF;
+    RETURN NULL;
+END;
+$BODY$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS subscriber_count
+    ON subscribes_to;
+
+CREATE TRIGGER subscriber_count
+    AFTER INSERT OR DELETE
+    ON subscribes_to
+    FOR EACH ROW
+EXECUTE FUNCTION count_subscriber();
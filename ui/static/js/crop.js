@@ -0,0 +1,98 @@
+// Choosing the square of a new profile picture. Without JavaScript the
+// middle of the picture is used.
+(function () {
+    'use strict';
+
+    const form = document.querySelector('form[data-crop]');
+    if (!form) {
+        return;
+    }
+
+    const input = form.querySelector('input[type=file]');
+    const preview = form.querySelector('[data-crop-preview]');
+    const img = preview.querySelector('img');
+    const box = preview.querySelector('[data-crop-box]');
+    const zoom = form.querySelector('[data-crop-zoom]');
+    const fields = {
+        x: form.querySelector('input[name=crop-x]'),
+        y: form.querySelector('input[name=crop-y]'),
+        size: form.querySelector('input[name=crop-size]'),
+    };
+
+    // the crop in the pixels of the picture
+    const crop = {x: 0, y: 0, size: 0};
+
+    function clamp(v, min, max) {
+        return Math.min(Math.max(v, min), max);
+    }
+
+    function update() {
+        const w = img.naturalWidth;
+        const h = img.naturalHeight;
+        crop.size = Math.round(Math.min(w, h) * zoom.value / 100);
+        crop.x = clamp(Math.round(crop.x), 0, w - crop.size);
+        crop.y = clamp(Math.round(crop.y), 0, h - crop.size);
+
+        const scale = img.clientWidth / w;
+        box.style.left = crop.x * scale + 'px';
+        box.style.top = crop.y * scale + 'px';
+        box.style.width = box.style.height = crop.size * scale + 'px';
+
+        fields.x.value = crop.x;
+        fields.y.value = crop.y;
+        fields.size.value = crop.size;
+    }
+
+    input.addEventListener('change', function () {
+        const file = input.files[0];
+        if (!file) {
+            preview.hidden = zoom.hidden = true;
+            fields.size.value = '';
+            return;
+        }
+        img.onload = function () {
+            preview.hidden = zoom.hidden = false;
+            zoom.value = 100;
+            crop.x = (img.naturalWidth - Math.min(img.naturalWidth, img.naturalHeight)) / 2;
+            crop.y = (img.naturalHeight - Math.min(img.naturalWidth, img.naturalHeight)) / 2;
+            update();
+        };
+        img.src = URL.createObjectURL(file);
+    });
+
+    zoom.addEventListener('input', function () {
+        // zoom around the middle of the crop
+        const middle = {x: crop.x + crop.size / 2, y: crop.y + crop.size / 2};
+        const size = Math.min(img.naturalWidth, img.naturalHeight) * zoom.value / 100;
+        crop.x = middle.x - size / 2;
+        crop.y = middle.y - size / 2;
+        update();
+    });
+
+    box.addEventListener('pointerdown', function (e) {
+        e.preventDefault();
+        box.setPointerCapture(e.pointerId);
+        const start = {x: e.clientX, y: e.clientY, cropX: crop.x, cropY: crop.y};
+        const scale = img.clientWidth / img.naturalWidth;
+
+        function move(e) {
+            crop.x = start.cropX + (e.clientX - start.x) / scale;
+            crop.y = start.cropY + (e.clientY - start.y) / scale;
+            update();
+        }
+
+        function up() {
+            box.removeEventListener('pointermove', move);
+            box.removeEventListener('pointerup', up);
+        }
+
+        box.addEventListener('pointermove', move);
+        box.addEventListener('pointerup', up);
+    });
+
+    window.addEventListener('resize', function () {
+        if (!preview.hidden) {
+            update();
+        }
+    });
+})();
@@ -0,0 +1,39 @@
+// Loading embeds of third parties in a frame once their facade is clicked.
+// Until then nothing is requested from them, and without JavaScript the
+// facade links to the content instead.
+(function () {
+    'use strict';
+
+    document.querySelectorAll('[data-embed-src]').forEach(function (embed) {
+        const load = embed.querySelector('.embed-load');
+        if (!load) {
+            return;
+        }
+
+        load.addEventListener('click', function (e) {
+            e.preventDefault();
+
+            const src = embed.dataset.embedSrc;
+            const frame = document.createElement('iframe');
+            frame.className = 'embed-frame';
+            frame.loading = 'lazy';
+            frame.referrerPolicy = 'no-referrer';
+            frame.title = load.textContent;
+
+            if (src.endsWith('.js')) {
+                // gists are scripts writing themselves into the document,
+                // so they get one of their own with no access to the page
+                frame.sandbox = 'allow-scripts allow-popups';
+                frame.srcdoc = '<base target="_blank"><script src="' + encodeURI(src) + '"></scr' + 'ipt>';
+            } else {
+                frame.sandbox = 'allow-scripts allow-same-origin allow-popups allow-presentation';
+                frame.allow = 'fullscreen; picture-in-picture';
+                frame.allowFullscreen = true;
+                frame.src = src;
+            }
+
+            embed.replaceChildren(frame);
+            embed.classList.add('embed-loaded');
+        });
+    });
+})();
@@ -0,0 +1,107 @@
+// Live updates over server-sent events. Everything here is optional: without
+// JavaScript the pages work through regular form posts and reloads.
+(function () {
+    'use strict';
+
+    if (!window.EventSource) {
+        return;
+    }
+
+    function listen(url, handlers) {
+        const source = new EventSource(url);
+        Object.keys(handlers).forEach(function (name) {
+            source.addEventListener(name, function (e) {
+                handlers[name](JSON.parse(e.data));
+            });
+        });
+    }
+
+    function setCount(el, count) {
+        if (el) {
+            el.textContent = count > 0 ? count : '';
+        }
+    }
+
+    function commentElement(comment) {
+        const section = document.createElement('section');
+        section.className = 'row mb-3';
+        section.id = 'comment-' + comment.id;
+
+        const likes = document.createElement('div');
+        likes.className = 'col-1 text-center';
+        const count = document.createElement('p');
+        count.className = 'fs-6 mt-4';
+        count.dataset.commentLikes = comment.id;
+        count.textContent = '0';
+        likes.appendChild(count);
+
+        const body = document.createElement('div');
+        body.className = 'col container mb-3';
+
+        const header = document.createElement('div');
+        header.className = 'row mx-0 mb-1';
+        const pic = document.createElement('img');
+        pic.className = 'rounded-circle col-auto px-0 me-2';
+        pic.src = comment.commenter.pic;
+        pic.alt = 'Profile pic';
+        pic.style.width = '32px';
+        const name = document.createElement('a');
+        name.className = 'col-auto px-0 me-2 my-auto';
+        name.href = comment.commenter.url;
+        name.textContent = comment.commenter.name;
+        const time = document.createElement('time');
+        time.className = 'col-auto px-0 my-auto';
+        time.dateTime = comment.createdAt;
+        time.textContent = comment.humanDate;
+        header.append(pic, name, time);
+
+        const content = document.createElement('div');
+        content.className = 'text-break text-wrap';
+        const p = document.createElement('p');
+        p.textContent = comment.content;
+        content.appendChild(p);
+
+        body.append(header, content);
+        section.append(likes, body);
+        return section;
+    }
+
+    const comments = document.getElementById('comments');
+    if (comments && comments.dataset.events) {
+        listen(comments.dataset.events, {
+            'like': function (data) {
+                setCount(document.getElementById('article-like-count'), data.count);
+            },
+            'comment-like': function (data) {
+                const el = document.querySelector('[data-comment-likes="' + data.id + '"]');
+                if (el) {
+                    el.textContent = data.count;
+                }
+            },
+            'comment': function (data) {
+                if (document.getElementById('comment-' + data.id)) {
+                    return;
+                }
+                const list = document.getElementById('comment-list');
+                list.insertBefore(commentElement(data), list.firstChild);
+
+                const count = document.getElementById('comment-count');
+                setCount(count, list.children.length);
+            },
+        });
+    }
+
+    const url = document.body.dataset.notificationEvents;
+    if (url) {
+        listen(url, {
+            'notification': function (data) {
+                const badge = document.getElementById('notification-badge');
+                if (!badge) {
+                    return;
+                }
+                document.getElementById('notification-count').textContent = data.unread;
+                badge.classList.toggle('d-none', data.unread === 0);
+            },
+        });
+    }
+})();